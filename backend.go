@@ -0,0 +1,135 @@
+package vclock
+
+import (
+	"context"
+	"sync"
+)
+
+// Backend identifies the mechanism used by a VClock to serialise
+// access to its state
+type Backend int
+
+const (
+	ChannelBackend Backend = iota // Requests are processed sequentially by a dedicated goroutine
+	MutexBackend                  // Requests are processed by the caller, guarded by a sync.RWMutex
+)
+
+func (b Backend) String() string {
+	switch b {
+	case ChannelBackend:
+		return "Channel"
+	case MutexBackend:
+		return "Mutex"
+	}
+	return "Unknown"
+}
+
+// backend applies requests to the clockState of a VClock
+type backend interface {
+	send(r any) (any, error)
+	wait()
+}
+
+// channelBackend passes each request to a goroutine that owns the clockState.
+// The channels are never closed, as there may be many senders, so instead
+// requests are rejected once the context is completed, and done is closed
+// when the goroutine exits.
+type channelBackend struct {
+	ctx  context.Context
+	req  chan any
+	resp chan any
+	done chan struct{}
+}
+
+// newChannelBackend starts the goroutine that processes requests, which
+// exits when the context is completed
+func newChannelBackend(ctx context.Context, state *clockState) *channelBackend {
+	b := &channelBackend{
+		ctx:  ctx,
+		req:  make(chan any),
+		resp: make(chan any),
+		done: make(chan struct{}),
+	}
+
+	waiter := make(chan bool)
+
+	go func() {
+
+		defer close(b.done)
+
+		// Signal ready
+		waiter <- true
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case r := <-b.req:
+				b.resp <- state.process(r)
+			}
+		}
+	}()
+
+	// Wait until ready
+	<-waiter
+	close(waiter)
+
+	return b
+}
+
+// send returns errClosedVClock should the context be completed before the
+// request is accepted, otherwise it returns the response to the request
+func (b *channelBackend) send(r any) (any, error) {
+	if b.ctx.Err() != nil {
+		return nil, errClosedVClock
+	}
+
+	select {
+	case <-b.ctx.Done():
+		return nil, errClosedVClock
+	case b.req <- r:
+	}
+	return <-b.resp, nil
+}
+
+// wait blocks until the goroutine has exited, once the context is completed
+func (b *channelBackend) wait() {
+	<-b.done
+}
+
+// mutexBackend processes requests in the calling goroutine, allowing
+// read only requests to proceed in parallel
+type mutexBackend struct {
+	mu    sync.RWMutex
+	ctx   context.Context
+	state *clockState
+}
+
+// newMutexBackend creates a backend that is closed when the context is completed
+func newMutexBackend(ctx context.Context, state *clockState) *mutexBackend {
+	return &mutexBackend{
+		ctx:   ctx,
+		state: state,
+	}
+}
+
+func (b *mutexBackend) send(r any) (any, error) {
+	if isReadOnly(r) {
+		b.mu.RLock()
+		defer b.mu.RUnlock()
+	} else {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+	}
+
+	if b.ctx.Err() != nil {
+		return nil, errClosedVClock
+	}
+	return b.state.process(r), nil
+}
+
+// wait blocks until any request being processed has completed, once the context is completed
+func (b *mutexBackend) wait() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+}
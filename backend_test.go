@@ -0,0 +1,135 @@
+package vclock
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+// TestMain runs all tests and examples against each Backend
+func TestMain(m *testing.M) {
+	for _, b := range []Backend{ChannelBackend, MutexBackend} {
+		defaultBackend = b
+		if code := m.Run(); code != 0 {
+			fmt.Printf("failed with backend %v\n", b)
+			os.Exit(code)
+		}
+	}
+	os.Exit(0)
+}
+
+func TestWithBackend(t *testing.T) {
+
+	ctx := context.Background()
+
+	v1, err := New(ctx, Clock{"a": 1}, "", WithBackend(MutexBackend))
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v1.Close()
+
+	if _, ok := v1.backend.(*mutexBackend); !ok {
+		t.Fatalf("unexpected backend %T\n", v1.backend)
+	}
+
+	v2, err := v1.Copy()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v2.Close()
+
+	if _, ok := v2.backend.(*mutexBackend); !ok {
+		t.Fatalf("backend not preserved by Copy: %T\n", v2.backend)
+	}
+
+	v3, err := New(ctx, Clock{"a": 1}, "", WithBackend(ChannelBackend))
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v3.Close()
+
+	if _, ok := v3.backend.(*channelBackend); !ok {
+		t.Fatalf("unexpected backend %T\n", v3.backend)
+	}
+}
+
+func TestMutexBackendConcurrentAccess(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0, "b": 0}, "SHA256", WithBackend(MutexBackend))
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	other, _ := New(ctx, Clock{"a": 1}, "")
+	defer other.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if i%2 == 0 {
+					v.Tick("a")
+				} else {
+					v.Get("a")
+					v.GetClock()
+					v.Compare(other)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if val, ok := v.Get("a"); !ok || val != 500 {
+		t.Fatalf("unexpected value: %v %v\n", val, ok)
+	}
+
+	h, err := v.GetHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if len(h) != 501 {
+		t.Fatalf("unexpected history length: %v\n", len(h))
+	}
+}
+
+func TestCloseWithConcurrentRequests(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := New(ctx, Clock{"a": 0}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if err := v.Tick("a"); err != nil {
+					if err != errClosedVClock {
+						t.Errorf("unexpected error %q\n", err.Error())
+					}
+					return
+				}
+			}
+		}()
+	}
+
+	if err := v.Close(); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	wg.Wait()
+
+	if err := v.Tick("a"); err != errClosedVClock {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errClosedVClock.Error(), err)
+	}
+}
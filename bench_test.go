@@ -5,7 +5,9 @@ import (
 	"context"
 	"encoding/gob"
 	"fmt"
+	"runtime"
 	"testing"
+	"time"
 
 	"golang.org/x/exp/rand"
 )
@@ -232,3 +234,127 @@ func BenchmarkNewOnly(b *testing.B) {
 		New(ctx, Clock{"a": 0}, "")
 	}
 }
+
+func BenchmarkClockTick(b *testing.B) {
+
+	c := Clock{"a": 0}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Tick("a")
+	}
+
+	if v, ok := c.Get("a"); !ok || v != uint64(b.N) {
+		b.Fatalf("Clock has wrong value: expected %v, got %v\n", b.N, v)
+	}
+}
+
+func BenchmarkClockMergeLarge(b *testing.B) {
+
+	other := Clock{}
+	for i := 0; i < 1024; i++ {
+		other[fmt.Sprint(i)] = rand.Uint64()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c := Clock{"a": 0}
+		c.Merge(other)
+	}
+}
+
+func BenchmarkTickMutex(b *testing.B) {
+
+	ctx := context.Background()
+
+	c, _ := New(ctx, Clock{"a": 0}, "", WithBackend(MutexBackend))
+	defer c.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Tick("a")
+	}
+
+	if v, ok := c.Get("a"); !ok || v != uint64(b.N) {
+		b.Fatalf("Clock has wrong value: expected %v, got %v\n", b.N, v)
+	}
+}
+
+func benchmarkGetParallel(b *testing.B, backend Backend) {
+
+	ctx := context.Background()
+
+	c, _ := New(ctx, Clock{"a": 0, "b": 0}, "", WithBackend(backend))
+	defer c.Close()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Get("a")
+		}
+	})
+}
+
+func BenchmarkGetParallelChannel(b *testing.B) {
+	benchmarkGetParallel(b, ChannelBackend)
+}
+
+func BenchmarkGetParallelMutex(b *testing.B) {
+	benchmarkGetParallel(b, MutexBackend)
+}
+
+// benchmarkHistoryRetained reports the heap retained by the history of a
+// clock with 1024 identifiers after 1024 ticks, as stored by the function
+func benchmarkHistoryRetained(b *testing.B, store func(c Clock, ticks int) any) {
+
+	c := Clock{}
+	for i := 0; i < 1024; i++ {
+		c[fmt.Sprint(i)] = 0
+	}
+
+	var before, after runtime.MemStats
+	retained := uint64(0)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		h := store(c, 1024)
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		runtime.KeepAlive(h)
+
+		if after.HeapAlloc > before.HeapAlloc {
+			retained += after.HeapAlloc - before.HeapAlloc
+		}
+	}
+
+	b.ReportMetric(float64(retained)/float64(b.N), "retained-B/op")
+}
+
+func BenchmarkHistoryRetained(b *testing.B) {
+	benchmarkHistoryRetained(b, func(c Clock, ticks int) any {
+		shortener, _ := GetShortenerFactory().Get("NoOp")
+		h := newHistory(c, shortener, false, time.Now)
+		for i := 0; i < ticks; i++ {
+			h.apply(&Event{Type: Tick, Tick: fmt.Sprint(i % len(c))})
+		}
+		return h
+	})
+}
+
+// BenchmarkHistoryRetainedFullCopy provides a comparison with retaining a
+// full copy of the clock for every item in the history
+func BenchmarkHistoryRetainedFullCopy(b *testing.B) {
+	benchmarkHistoryRetained(b, func(c Clock, ticks int) any {
+		items := []Clock{copyMap(c)}
+		for i := 0; i < ticks; i++ {
+			m := Clock(copyMap(items[len(items)-1]))
+			m.Tick(fmt.Sprint(i % len(c)))
+			items = append(items, m)
+		}
+		return items
+	})
+}
@@ -0,0 +1,116 @@
+package vclock
+
+// RelationMatrix returns the Ordering of every pair of clocks, where the
+// element [i][j] is the relationship of clocks[j] to clocks[i], as returned
+// by clocks[i].Compare(clocks[j])
+func RelationMatrix(clocks []Clock) [][]Ordering {
+	m := make([][]Ordering, len(clocks))
+	for i := range clocks {
+		m[i] = make([]Ordering, len(clocks))
+	}
+
+	for i := range clocks {
+		m[i][i] = Equal
+		for j := i + 1; j < len(clocks); j++ {
+			o := ordering(clocks[i], clocks[j])
+			m[i][j] = o
+			m[j][i] = o.reverse()
+		}
+	}
+	return m
+}
+
+// reverse returns the Ordering from the perspective of the other clock
+func (o Ordering) reverse() Ordering {
+	switch o {
+	case Ancestor:
+		return Descendant
+	case Descendant:
+		return Ancestor
+	}
+	return o
+}
+
+// CausalSort returns the clocks ordered so that every clock appears after
+// all of its ancestors.  The sort is stable, so that equal and concurrent
+// clocks retain their relative order where causality allows.
+func CausalSort(clocks []Clock) []Clock {
+	m := RelationMatrix(clocks)
+
+	// Count the ancestors of each clock that are yet to be placed
+	pending := make([]int, len(clocks))
+	for i := range clocks {
+		for j := range clocks {
+			if m[i][j] == Ancestor {
+				pending[i]++
+			}
+		}
+	}
+
+	ret := make([]Clock, 0, len(clocks))
+	placed := make([]bool, len(clocks))
+	for len(ret) < len(clocks) {
+		for i := range clocks {
+			if placed[i] || pending[i] > 0 {
+				continue
+			}
+			placed[i] = true
+			ret = append(ret, clocks[i])
+			for j := range clocks {
+				if m[i][j] == Descendant {
+					pending[j]--
+				}
+			}
+			break
+		}
+	}
+	return ret
+}
+
+// Maxima returns the clocks that are not the ancestor of any other clock;
+// i.e. the concurrent frontier of the clocks.  Where several clocks are
+// equal, only the first is returned.
+func Maxima(clocks []Clock) []Clock {
+	m := RelationMatrix(clocks)
+
+	ret := []Clock{}
+	for i := range clocks {
+		maximal := true
+		for j := range clocks {
+			if m[i][j] == Descendant || (j < i && m[i][j] == Equal) {
+				maximal = false
+				break
+			}
+		}
+		if maximal {
+			ret = append(ret, clocks[i])
+		}
+	}
+	return ret
+}
+
+// ConcurrentClasses groups the clocks by their causal depth, being the length of
+// the longest chain of ancestors of each clock within the clocks.  No clock within
+// a group is the ancestor of another in the same group, and the groups are returned
+// in causal order, so that the first group holds the clocks with no ancestors.
+func ConcurrentClasses(clocks []Clock) [][]Clock {
+	sorted := CausalSort(clocks)
+	m := RelationMatrix(sorted)
+
+	// As sorted is in causal order, the depth of each ancestor
+	// is known before the depth of its descendants is calculated
+	depth := make([]int, len(sorted))
+	ret := [][]Clock{}
+	for i := range sorted {
+		for j := 0; j < i; j++ {
+			if m[i][j] == Ancestor && depth[j]+1 > depth[i] {
+				depth[i] = depth[j] + 1
+			}
+		}
+		if depth[i] == len(ret) {
+			ret = append(ret, []Clock{})
+		}
+		ret[depth[i]] = append(ret[depth[i]], sorted[i])
+	}
+	return ret
+}
@@ -5,8 +5,8 @@ import (
 	"context"
 	"encoding/gob"
 	"errors"
+	"time"
 
-	"github.com/gford1000-go/chant"
 	"github.com/gford1000-go/syncmap"
 )
 
@@ -14,36 +14,26 @@ import (
 type Clock map[string]uint64
 
 type AllowedReq interface {
-	Clock | *respComp | *reqFullHistory | *reqGet | *reqHistory | *reqLastUpdate | *reqPrune | *reqSnap | *reqSnapShortenedIdentifiers | *SetInfo | *reqTick
+	*respComp | *reqOrdering | *reqFullHistory | *reqGet | *reqHistory | *reqLastUpdate | *reqPrune | *reqSnap | *reqSnapShortenedIdentifiers | *reqTick | *reqTickAndSnap | *reqReceive | *reqUpdate | *reqRetire | *reqRetired | *reqSetMax | *reqAdvance | *reqDiff | *reqLag | *reqHistoryInfo | *reqHistoryRange | *reqFullHistoryRange | *reqQueryHistory | *reqClockAt | *reqClockAtId | *reqFork | *reqSet | *reqMerge
 }
 
 type AllowedResp interface {
-	*respClock | *respErr | bool | *respGetter | *respGetterWithStatus | *respHistory | *respHistoryAll
+	*respClock | *respErr | bool | Ordering | *respGetter | *respGetterWithStatus | *respHistory | *respHistoryAll | *respDiff | *respLag | *respHistoryInfo | *respFork
 }
 
-// attemptSendChanWithResp will stop the panic and return recoverErr, should the chan be closed
-func attemptSendChanWithResp[T AllowedReq, U AllowedResp](c *chant.Channel[any], t T, r *chant.Channel[any], recoverErr error) (u U, err error) {
-	handleChanErr := func(e error) (U, error) {
-		var u U
-		if !errors.Is(e, chant.ErrChannelClosed) {
-			return u, e
-		}
-		return u, recoverErr
-	}
-
-	if err := c.Send(t); err != nil {
-		return handleChanErr(err)
-	}
-	if resp, err := r.Recv(); err != nil {
-		return handleChanErr(err)
-	} else {
-		return resp.(U), nil
+// attemptSendWithResp passes the request to the backend and returns its response,
+// or errClosedVClock should the backend be closed
+func attemptSendWithResp[T AllowedReq, U AllowedResp](b backend, t T) (u U, err error) {
+	resp, err := b.send(t)
+	if err != nil {
+		return u, err
 	}
+	return resp.(U), nil
 }
 
-// attemptSendChan is syntax sugar to simply the call when only an error would be returned
-func attemptSendChan[T AllowedReq](c *chant.Channel[any], t T, r *chant.Channel[any], recoverErr error) error {
-	resp, err := attemptSendChanWithResp[T, *respErr](c, t, r, recoverErr)
+// attemptSend is syntax sugar to simply the call when only an error would be returned
+func attemptSend[T AllowedReq](b backend, t T) error {
+	resp, err := attemptSendWithResp[T, *respErr](b, t)
 	if err != nil {
 		return err
 	}
@@ -60,12 +50,64 @@ type reqGet struct {
 type reqHistory struct {
 }
 
+type reqHistoryInfo struct {
+}
+
+type reqClockAt struct {
+	t time.Time
+}
+
+type reqClockAtId struct {
+	id uint64
+}
+
+type reqFork struct {
+	id          uint64
+	keepHistory bool
+}
+
+type reqQueryHistory struct {
+	q HistoryQuery
+}
+
+type reqHistoryRange struct {
+	from uint64
+	to   uint64
+}
+
+type reqFullHistoryRange struct {
+	from uint64
+	to   uint64
+}
+
 type reqLastUpdate struct {
 }
 
 type reqPrune struct {
 }
 
+type reqReceive struct {
+	id     string
+	remote Clock
+}
+
+type reqRetire struct {
+	id string
+}
+
+type reqRetired struct {
+}
+
+type reqSetMax struct {
+	id string
+	v  uint64
+}
+
+type reqAdvance struct {
+	id string
+	n  uint64
+}
+
 type reqSnap struct {
 }
 
@@ -74,6 +116,22 @@ type reqSnapShortenedIdentifiers struct {
 
 type reqTick struct {
 	id string
+	md map[string]string
+}
+
+type reqSet struct {
+	s  *SetInfo
+	md map[string]string
+}
+
+type reqMerge struct {
+	c  Clock
+	md map[string]string
+}
+
+type reqTickAndSnap struct {
+	id        string
+	shortened bool
 }
 
 type respClock struct {
@@ -101,6 +159,18 @@ type respHistory struct {
 	e error
 }
 
+type respFork struct {
+	items   []*HistoryItem
+	retired Clock
+	e       error
+}
+
+type respHistoryInfo struct {
+	first uint64
+	last  uint64
+	n     int
+}
+
 type respHistoryAll struct {
 	h []*HistoryItem
 	e error
@@ -109,39 +179,80 @@ type respHistoryAll struct {
 var errClockIdMustNotBeEmptyString = errors.New("clock identifier must not be empty string")
 var errAttemptToSetExistingId = errors.New("clock identifier cannot be reset once initialised")
 var errAttemptToTickUnknownId = errors.New("attempted to tick unknown clock identifier")
+var errAttemptToAdvanceUnknownId = errors.New("attempted to advance unknown clock identifier")
+var errAttemptToOverflowId = errors.New("attempted to advance clock identifier beyond its maximum value")
+var errAttemptToRetireUnknownId = errors.New("attempted to retire unknown clock identifier")
 var errClosedVClock = errors.New("attempt to interact with closed clock")
 var errClockMustNotBeNil = errors.New("attempt to merge a nil clock")
+var errChunkSizeMustBePositive = errors.New("chunk size must be greater than zero")
+var errWalkFuncMustNotBeNil = errors.New("walk function must not be nil")
 var errUnknownReqType = errors.New("received unknown request struct")
 
 // VClock is an instance of a vector clock that can suppport
 // concurrent use across multiple goroutines
 type VClock struct {
-	req       *chant.Channel[any]
-	resp      *chant.Channel[any]
-	shortener string
-	ctx       context.Context
-	cancel    context.CancelFunc
+	backend     backend
+	shortener   string
+	compareMode CompareMode
+	opts        []Option
+	ctx         context.Context
+	cancel      context.CancelFunc
+	wal         *wal
 }
 
 // New returns a VClock that is initialised with the specified Clock details,
 // and which will not maintain any history.  The specified shortener
 // (which may be empty string) reduces the memory footprint of the vector
-// clock if the identifiers are large strings.
-func New(context context.Context, init Clock, shortenerName string) (*VClock, error) {
-	return newClock(context, init, false, shortenerName, true)
+// clock if the identifiers are large strings.  Options, such as the
+// backend to be used, may also be supplied.
+func New(context context.Context, init Clock, shortenerName string, opts ...Option) (*VClock, error) {
+	return newClock(context, init, false, shortenerName, true, opts)
 }
 
 // NewWithHistory returns a VClock that is initialised with the specified Clock details,
 // and which will maintain a full history of all updates.  The specified shortener
 // (which may be empty string) reduces the memory footprint of the vector
-// clock if the identifiers are large strings.
-func NewWithHistory(context context.Context, init Clock, shortenerName string) (*VClock, error) {
-	return newClock(context, init, true, shortenerName, true)
+// clock if the identifiers are large strings.  Options, such as the
+// backend to be used, may also be supplied.
+func NewWithHistory(context context.Context, init Clock, shortenerName string, opts ...Option) (*VClock, error) {
+	return newClock(context, init, true, shortenerName, true, opts)
 }
 
-// Close releases all resources associated with the VClock instance
+// NewFromHistory returns a VClock that maintains history, rebuilt by replaying the
+// Change of each of the items in turn, such as those returned by GetFullHistory.
+// The Clock of the first item provides the initial state, and the HistoryId and
+// time of each item are retained.  The Clock resulting from each Change is verified
+// against that recorded, with the first divergence reported as a *HistoryDivergenceError.
+func NewFromHistory(context context.Context, items []*HistoryItem, shortenerName string, opts ...Option) (*VClock, error) {
+	if len(items) == 0 {
+		return nil, errHistoryMustNotBeEmpty
+	}
+	for _, item := range items {
+		if item == nil {
+			return nil, errHistoryItemMustNotBeNil
+		}
+	}
+
+	v, state, o := newClockState(context, items[0].Clock, true, shortenerName, true, opts)
+	if err := state.history.replay(items); err != nil {
+		v.cancel()
+		return nil, err
+	}
+
+	v.start(state, o.backend)
+	return v, nil
+}
+
+// Close releases all resources associated with the VClock instance,
+// returning once no further requests can be processed.
+// For a VClock created by Open, the write-ahead log is then synchronised
+// and closed, with any error in doing so being returned.
 func (vc *VClock) Close() error {
 	vc.cancel()
+	vc.backend.wait()
+	if vc.wal != nil {
+		return vc.wal.close()
+	}
 	return nil
 }
 
@@ -149,19 +260,76 @@ func (vc *VClock) Close() error {
 // The identifier must not be an empty string, nor can an
 // identifier be set more than once
 func (vc *VClock) Set(id string, v uint64) error {
-	return attemptSendChan(vc.req, &SetInfo{Id: id, Value: v}, vc.resp, errClosedVClock)
+	return attemptSend(vc.backend, &reqSet{s: &SetInfo{Id: id, Value: v}})
+}
+
+// SetWithMetadata behaves as Set, recording a copy of the metadata
+// against the Event in the history of the clock
+func (vc *VClock) SetWithMetadata(id string, v uint64, md map[string]string) error {
+	return attemptSend(vc.backend, &reqSet{s: &SetInfo{Id: id, Value: v}, md: copyMetadata(md)})
+}
+
+// SetMax assigns the specified value to the given clock identifier if the
+// identifier is not present, or if the value is greater than its current value.
+// The value of an identifier is never lowered.  The identifier must not be an
+// empty string
+func (vc *VClock) SetMax(id string, v uint64) error {
+	return attemptSend(vc.backend, &reqSetMax{id: id, v: v})
+}
+
+// Advance adds n to the clock with the specified identifier, as a single update.
+// An error is raised if the identifier is not found in the vector clock, or if
+// its value would overflow, in which case the vector clock is unchanged
+func (vc *VClock) Advance(id string, n uint64) error {
+	return attemptSend(vc.backend, &reqAdvance{id: id, n: n})
 }
 
 // Tick increments the clock with the specified identifier.
 // An error is raised if the identifier is not found in the vector clock
 func (vc *VClock) Tick(id string) error {
-	return attemptSendChan(vc.req, &reqTick{id: id}, vc.resp, errClosedVClock)
+	return attemptSend(vc.backend, &reqTick{id: id})
+}
+
+// TickWithMetadata behaves as Tick, recording a copy of the metadata
+// against the Event in the history of the clock
+func (vc *VClock) TickWithMetadata(id string, md map[string]string) error {
+	return attemptSend(vc.backend, &reqTick{id: id, md: copyMetadata(md)})
+}
+
+// TickAndGet increments the clock with the specified identifier and returns
+// a copy of the resulting vector clock map, as a single operation so that
+// no other update can be applied in between.
+// An error is raised if the identifier is not found in the vector clock
+func (vc *VClock) TickAndGet(id string) (Clock, error) {
+	resp, err := attemptSendWithResp[*reqTickAndSnap, *respClock](vc.backend, &reqTickAndSnap{id: id})
+	if err != nil {
+		return nil, err
+	}
+	if resp.e != nil {
+		return nil, resp.e
+	}
+	return resp.c, nil
+}
+
+// TickAndBytes increments the clock with the specified identifier and returns
+// the resulting vector clock encoded as per Bytes, as a single operation so that
+// no other update can be applied in between.
+// An error is raised if the identifier is not found in the vector clock
+func (vc *VClock) TickAndBytes(id string) ([]byte, error) {
+	resp, err := attemptSendWithResp[*reqTickAndSnap, *respClock](vc.backend, &reqTickAndSnap{id: id, shortened: true})
+	if err != nil {
+		return nil, err
+	}
+	if resp.e != nil {
+		return nil, resp.e
+	}
+	return vc.serialise(resp.c)
 }
 
 // Get returns the latest clock value for the specified identifier,
 // returning true if the identifier is found, otherwise false
 func (vc *VClock) Get(id string) (uint64, bool) {
-	resp, err := attemptSendChanWithResp[*reqGet, *respGetterWithStatus](vc.req, &reqGet{id: id}, vc.resp, errClosedVClock)
+	resp, err := attemptSendWithResp[*reqGet, *respGetterWithStatus](vc.backend, &reqGet{id: id})
 	if err != nil {
 		return 0, false
 	}
@@ -170,7 +338,7 @@ func (vc *VClock) Get(id string) (uint64, bool) {
 
 // GetClock returns a copy of the complete vector clock map
 func (vc *VClock) GetClock() (Clock, error) {
-	resp, err := attemptSendChanWithResp[*reqSnap, *respClock](vc.req, &reqSnap{}, vc.resp, errClosedVClock)
+	resp, err := attemptSendWithResp[*reqSnap, *respClock](vc.backend, &reqSnap{})
 	if err != nil {
 		return nil, err
 	}
@@ -183,7 +351,7 @@ func (vc *VClock) GetClock() (Clock, error) {
 // GetFullHistory returns a copy of each state change of the vectory clock map,
 // including the Event detail of the change as well as new state of the clock
 func (vc *VClock) GetFullHistory() ([]*HistoryItem, error) {
-	resp, err := attemptSendChanWithResp[*reqFullHistory, *respHistoryAll](vc.req, &reqFullHistory{}, vc.resp, errClosedVClock)
+	resp, err := attemptSendWithResp[*reqFullHistory, *respHistoryAll](vc.backend, &reqFullHistory{})
 	if err != nil {
 		return nil, err
 	}
@@ -195,7 +363,79 @@ func (vc *VClock) GetFullHistory() ([]*HistoryItem, error) {
 
 // GetHistory returns a copy of each state change of the vector clock map
 func (vc *VClock) GetHistory() ([]Clock, error) {
-	resp, err := attemptSendChanWithResp[*reqHistory, *respHistory](vc.req, &reqHistory{}, vc.resp, errClosedVClock)
+	resp, err := attemptSendWithResp[*reqHistory, *respHistory](vc.backend, &reqHistory{})
+	if err != nil {
+		return nil, err
+	}
+	if resp.e != nil {
+		return nil, resp.e
+	}
+	return resp.h, nil
+}
+
+// GetHistoryRange returns a copy of each state change of the vector clock map
+// with a HistoryId between from and to inclusive.  Only the available history
+// within the range is returned, so the result may be empty.
+func (vc *VClock) GetHistoryRange(from, to uint64) ([]Clock, error) {
+	resp, err := attemptSendWithResp[*reqHistoryRange, *respHistory](vc.backend, &reqHistoryRange{from: from, to: to})
+	if err != nil {
+		return nil, err
+	}
+	if resp.e != nil {
+		return nil, resp.e
+	}
+	return resp.h, nil
+}
+
+// GetFullHistoryRange returns a copy of each state change of the vector clock map,
+// including the Event detail of the change, with a HistoryId between from and to
+// inclusive.  Only the available history within the range is returned, so the
+// result may be empty.
+func (vc *VClock) GetFullHistoryRange(from, to uint64) ([]*HistoryItem, error) {
+	resp, err := attemptSendWithResp[*reqFullHistoryRange, *respHistoryAll](vc.backend, &reqFullHistoryRange{from: from, to: to})
+	if err != nil {
+		return nil, err
+	}
+	if resp.e != nil {
+		return nil, resp.e
+	}
+	return resp.h, nil
+}
+
+// GetClockAt returns a copy of the vector clock map as it was at the specified
+// time, according to the time source of this clock.  An error is returned if
+// the history prior to the time is not available.
+func (vc *VClock) GetClockAt(t time.Time) (Clock, error) {
+	resp, err := attemptSendWithResp[*reqClockAt, *respClock](vc.backend, &reqClockAt{t: t})
+	if err != nil {
+		return nil, err
+	}
+	if resp.e != nil {
+		return nil, resp.e
+	}
+	return resp.c, nil
+}
+
+// GetClockAtHistoryId returns a copy of the vector clock map as it was after the
+// update with the specified HistoryId.  An error is returned if the HistoryId
+// is not available in the history.
+func (vc *VClock) GetClockAtHistoryId(historyId uint64) (Clock, error) {
+	resp, err := attemptSendWithResp[*reqClockAtId, *respClock](vc.backend, &reqClockAtId{id: historyId})
+	if err != nil {
+		return nil, err
+	}
+	if resp.e != nil {
+		return nil, resp.e
+	}
+	return resp.c, nil
+}
+
+// QueryHistory returns a copy of each item in the history that satisfies
+// the query, with the filtering applied before any items are copied
+func (vc *VClock) QueryHistory(q HistoryQuery) ([]*HistoryItem, error) {
+	q.Ids = append([]string{}, q.Ids...)
+
+	resp, err := attemptSendWithResp[*reqQueryHistory, *respHistoryAll](vc.backend, &reqQueryHistory{q: q})
 	if err != nil {
 		return nil, err
 	}
@@ -205,19 +445,123 @@ func (vc *VClock) GetHistory() ([]Clock, error) {
 	return resp.h, nil
 }
 
+// GetHistoryLen returns the number of items available in the history
+func (vc *VClock) GetHistoryLen() (int, error) {
+	resp, err := attemptSendWithResp[*reqHistoryInfo, *respHistoryInfo](vc.backend, &reqHistoryInfo{})
+	if err != nil {
+		return 0, err
+	}
+	return resp.n, nil
+}
+
+// WalkHistory calls the function with a copy of each item in the history, from the
+// specified HistoryId up to the latest item at the time the walk starts.  Items are
+// retrieved in chunks of the specified size, so that other requests can be processed
+// by the clock between chunks.  Items that are pruned before their chunk is retrieved
+// are skipped.  The walk stops if the context is completed, or at the first error
+// returned by the function, with that error being returned.
+func (vc *VClock) WalkHistory(ctx context.Context, from uint64, chunkSize int, fn func(item *HistoryItem) error) error {
+	if chunkSize <= 0 {
+		return errChunkSizeMustBePositive
+	}
+	if fn == nil {
+		return errWalkFuncMustNotBeNil
+	}
+
+	info, err := attemptSendWithResp[*reqHistoryInfo, *respHistoryInfo](vc.backend, &reqHistoryInfo{})
+	if err != nil {
+		return err
+	}
+	if from < info.first {
+		from = info.first
+	}
+
+	for from <= info.last {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		to := from + uint64(chunkSize) - 1
+		if to > info.last {
+			to = info.last
+		}
+
+		items, err := vc.GetFullHistoryRange(from, to)
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+
+		from = to + 1
+	}
+	return nil
+}
+
+// LatestHistoryId returns the HistoryId of the latest item in the history
+func (vc *VClock) LatestHistoryId() (uint64, error) {
+	resp, err := attemptSendWithResp[*reqHistoryInfo, *respHistoryInfo](vc.backend, &reqHistoryInfo{})
+	if err != nil {
+		return 0, err
+	}
+	return resp.last, nil
+}
+
+// EarliestHistoryId returns the HistoryId of the earliest available item
+// in the history, which increases as the history is pruned
+func (vc *VClock) EarliestHistoryId() (uint64, error) {
+	resp, err := attemptSendWithResp[*reqHistoryInfo, *respHistoryInfo](vc.backend, &reqHistoryInfo{})
+	if err != nil {
+		return 0, err
+	}
+	return resp.first, nil
+}
+
 // Copy creates a new VClock instance, initialised to the
-// values of this instance
+// values of this instance and using the same options
 func (vc *VClock) Copy() (*VClock, error) {
 	m, err := vc.GetClock()
 	if err != nil {
 		return nil, err
 	}
-	return New(vc.ctx, m, vc.shortener)
+	return New(vc.ctx, m, vc.shortener, vc.opts...)
+}
+
+// ForkAt creates a new VClock instance, initialised to the values of this
+// instance as they were after the update with the specified HistoryId, and
+// using the same options.  Identifiers that were retired at that point remain
+// retired in the new instance.  If keepHistory is true, the new instance maintains
+// history, starting with the available history up to and including the HistoryId.
+// An error is returned if the HistoryId is not available in the history.
+func (vc *VClock) ForkAt(historyId uint64, keepHistory bool) (*VClock, error) {
+	resp, err := attemptSendWithResp[*reqFork, *respFork](vc.backend, &reqFork{id: historyId, keepHistory: keepHistory})
+	if err != nil {
+		return nil, err
+	}
+	if resp.e != nil {
+		return nil, resp.e
+	}
+
+	v, state, o := newClockState(vc.ctx, resp.items[0].Clock, keepHistory, vc.shortener, true, vc.opts)
+	state.history.setRetired(resp.retired)
+
+	if keepHistory {
+		if err := state.history.replay(resp.items); err != nil {
+			v.cancel()
+			return nil, err
+		}
+	}
+
+	v.start(state, o.backend)
+	return v, nil
 }
 
 // LastUpdate returns the latest clock time and its associated identifier
 func (vc *VClock) LastUpdate() (string, uint64, error) {
-	g, err := attemptSendChanWithResp[*reqLastUpdate, *respGetter](vc.req, &reqLastUpdate{}, vc.resp, errClosedVClock)
+	g, err := attemptSendWithResp[*reqLastUpdate, *respGetter](vc.backend, &reqLastUpdate{})
 	if err != nil {
 		return "", 0, err
 	}
@@ -239,12 +583,132 @@ func (vc *VClock) Merge(other *VClock) error {
 		return err
 	}
 
-	return attemptSendChan(vc.req, m, vc.resp, errClosedVClock)
+	return attemptSend(vc.backend, &reqMerge{c: m})
 }
 
-// Prune resets the clock history, so that only the latest is available
+// MergeWithMetadata behaves as Merge, recording a copy of the metadata
+// against the Event in the history of the clock
+func (vc *VClock) MergeWithMetadata(other *VClock, md map[string]string) error {
+	if other == nil {
+		return errClockMustNotBeNil
+	}
+
+	m, err := other.GetClock()
+	if err != nil {
+		return err
+	}
+
+	return attemptSend(vc.backend, &reqMerge{c: m, md: copyMetadata(md)})
+}
+
+// MergeAll combines this clock with all of the other clocks as a single update.
+// None of the other clocks may be nil, and none must be closed.
+// No update is made if no other clocks are provided
+func (vc *VClock) MergeAll(others ...*VClock) error {
+	if len(others) == 0 {
+		return nil
+	}
+
+	clocks := make([]Clock, 0, len(others))
+	for _, other := range others {
+		if other == nil {
+			return errClockMustNotBeNil
+		}
+
+		m, err := other.GetClock()
+		if err != nil {
+			return err
+		}
+		clocks = append(clocks, m)
+	}
+
+	return attemptSend(vc.backend, &reqMerge{c: Join(clocks...)})
+}
+
+// MergeClock combines this clock with the specified Clock, which must not be nil
+func (vc *VClock) MergeClock(c Clock) error {
+	if c == nil {
+		return errClockMustNotBeNil
+	}
+
+	return attemptSend(vc.backend, &reqMerge{c: copyMap(c)})
+}
+
+// MergeClockWithMetadata behaves as MergeClock, recording a copy of the metadata
+// against the Event in the history of the clock
+func (vc *VClock) MergeClockWithMetadata(c Clock, md map[string]string) error {
+	if c == nil {
+		return errClockMustNotBeNil
+	}
+
+	return attemptSend(vc.backend, &reqMerge{c: copyMap(c), md: copyMetadata(md)})
+}
+
+// MergeBytes combines this clock with the encoded vector clock, as created by
+// Bytes, without needing to create an intermediate VClock.
+func (vc *VClock) MergeBytes(data []byte) error {
+	cs, sourceShortener, err := decodeClock(data)
+	if err != nil {
+		return err
+	}
+
+	c, err := copyMapWithKeyModification(cs.C, sourceShortener.Recover)
+	if err != nil {
+		return err
+	}
+
+	return attemptSend(vc.backend, &reqMerge{c: c})
+}
+
+// Receive applies the vector clock receive rule as a single update: the remote
+// clock is merged into this clock, and then the clock with the specified local
+// identifier is incremented.  The resulting vector clock map is returned.
+// The remote clock must not be nil, and an error is raised if the local identifier
+// is found in neither clock
+func (vc *VClock) Receive(localId string, remote Clock) (Clock, error) {
+	if remote == nil {
+		return nil, errClockMustNotBeNil
+	}
+
+	resp, err := attemptSendWithResp[*reqReceive, *respClock](vc.backend, &reqReceive{id: localId, remote: copyMap(remote)})
+	if err != nil {
+		return nil, err
+	}
+	if resp.e != nil {
+		return nil, resp.e
+	}
+	return resp.c, nil
+}
+
+// Retire removes the specified identifier from the vector clock, recording
+// a tombstone with its final value.  Retired identifiers are excluded from
+// clocks that are subsequently merged, and are ignored within other clocks
+// during comparisons, so that clocks that have not yet dropped the identifier
+// are not considered to be ahead of this clock.  An identifier may be reintroduced
+// using Set.  Tombstones are local to this instance, and are not included in
+// Bytes or Copy.
+// An error is raised if the identifier is not found in the vector clock
+func (vc *VClock) Retire(id string) error {
+	return attemptSend(vc.backend, &reqRetire{id: id})
+}
+
+// GetRetired returns the tombstones of the retired identifiers,
+// with the value of each identifier when it was retired
+func (vc *VClock) GetRetired() (Clock, error) {
+	resp, err := attemptSendWithResp[*reqRetired, *respClock](vc.backend, &reqRetired{})
+	if err != nil {
+		return nil, err
+	}
+	if resp.e != nil {
+		return nil, resp.e
+	}
+	return resp.c, nil
+}
+
+// Prune resets the clock history, so that only the latest is available.
+// The latest item retains its HistoryId
 func (vc *VClock) Prune() error {
-	return attemptSendChan(vc.req, &reqPrune{}, vc.resp, errClosedVClock)
+	return attemptSend(vc.backend, &reqPrune{})
 }
 
 type clockSerialisation struct {
@@ -256,7 +720,7 @@ type clockSerialisation struct {
 // Bytes returns an encoded vector clock
 func (vc *VClock) Bytes() ([]byte, error) {
 
-	resp, err := attemptSendChanWithResp[*reqSnapShortenedIdentifiers, *respClock](vc.req, &reqSnapShortenedIdentifiers{}, vc.resp, errClosedVClock)
+	resp, err := attemptSendWithResp[*reqSnapShortenedIdentifiers, *respClock](vc.backend, &reqSnapShortenedIdentifiers{})
 	if err != nil {
 		return nil, err
 	}
@@ -264,6 +728,12 @@ func (vc *VClock) Bytes() ([]byte, error) {
 		return nil, resp.e
 	}
 
+	return vc.serialise(resp.c)
+}
+
+// serialise encodes the clock, which must use shortened identifiers,
+// together with the mappings of the shortener
+func (vc *VClock) serialise(c Clock) ([]byte, error) {
 	shortener, err := GetShortenerFactory().Get(vc.shortener)
 	if err != nil {
 		return nil, err
@@ -278,7 +748,7 @@ func (vc *VClock) Bytes() ([]byte, error) {
 	if err := enc.Encode(
 		&clockSerialisation{
 			B: b,
-			C: resp.c,
+			C: c,
 			S: vc.shortener,
 		}); err != nil {
 		return nil, err
@@ -288,27 +758,52 @@ func (vc *VClock) Bytes() ([]byte, error) {
 
 // FromBytesWithHistory decodes a vector clock and preserves history from this point forwards.  This requires both
 // the serialised clock and also the name of the IdentifierShortener to be used (which may be empty string)
-func FromBytesWithHistory(context context.Context, data []byte, shortenerName string) (vc *VClock, err error) {
-	return fromBytes(context, data, true, shortenerName)
+func FromBytesWithHistory(context context.Context, data []byte, shortenerName string, opts ...Option) (vc *VClock, err error) {
+	return fromBytes(context, data, true, shortenerName, opts)
 }
 
 // FromBytes decodes a vector clock.  This requires both
 // the serialised clock and also the name of the IdentifierShortener to be used (which may be empty string)
-func FromBytes(context context.Context, data []byte, shortenerName string) (vc *VClock, err error) {
-	return fromBytes(context, data, false, shortenerName)
+func FromBytes(context context.Context, data []byte, shortenerName string, opts ...Option) (vc *VClock, err error) {
+	return fromBytes(context, data, false, shortenerName, opts)
 }
 
-// fromBytes deseralises and initialises a VClock
-func fromBytes(context context.Context, data []byte, maintainHistory bool, shortenerName string) (vc *VClock, err error) {
+// decodeClock deseralises a vector clock, ensuring the shortener instance
+// in this process has the same set of mappings as the source of the serialised
+// clock.  The Clock retains the shortened identifiers, so the source shortener
+// is also returned.
+func decodeClock(data []byte) (*clockSerialisation, IdentifierShortener, error) {
 	b := new(bytes.Buffer)
 	b.Write(data)
 	dec := gob.NewDecoder(b)
 
-	cs := clockSerialisation{
+	cs := &clockSerialisation{
 		C: Clock{},
 	}
 
-	if err := dec.Decode(&cs); err != nil {
+	if err := dec.Decode(cs); err != nil {
+		return nil, nil, err
+	}
+
+	sourceShortener, err := GetShortenerFactory().Get(cs.S)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Once merged, the shortener has all necessary mappings to be able to fully
+	// recover the original identifiers for all entries in the clock, without
+	// needing a central service.
+	if err := sourceShortener.Merge(cs.B); err != nil {
+		return nil, nil, err
+	}
+
+	return cs, sourceShortener, nil
+}
+
+// fromBytes deseralises and initialises a VClock
+func fromBytes(context context.Context, data []byte, maintainHistory bool, shortenerName string, opts []Option) (vc *VClock, err error) {
+	cs, sourceShortener, err := decodeClock(data)
+	if err != nil {
 		return nil, err
 	}
 
@@ -316,39 +811,22 @@ func fromBytes(context context.Context, data []byte, maintainHistory bool, short
 	if shortenerName == "" {
 		shortenerName = getDefaultShortenerName()
 	}
-	sourceShortener, err := GetShortenerFactory().Get(cs.S)
-	if err != nil {
-		return nil, err
-	}
 
 	// As the Clock was serialised using shortened identifiers,
 	// if the preferred shortener name differs from that used by the serialising
 	// clock, then need to recover to the unshortened identifiers
 	if cs.S != shortenerName {
-		newC := Clock{}
-		for k, v := range cs.C {
-			kk, err := sourceShortener.Recover(k)
-			if err != nil {
-				return nil, err
-			}
-			newC[kk] = v
+		newC, err := copyMapWithKeyModification(cs.C, sourceShortener.Recover)
+		if err != nil {
+			return nil, err
 		}
 
-		return newClock(context, newC, maintainHistory, shortenerName, true)
-	}
-
-	// The two clocks are using the same shortener, we now need to ensure the shortener
-	// instance in this process has the same set of mappings as the source of the
-	// process whose clock is being merged.
-	err = sourceShortener.Merge(cs.B)
-	if err != nil {
-		return nil, err
+		return newClock(context, newC, maintainHistory, shortenerName, true, opts)
 	}
 
-	// The new clock can be created successfully, since the shortener now
-	// has all necessary mappings to be able to fully recover the original identifiers
-	// for all entries in the clock, without needing a central service.
-	return newClock(context, cs.C, maintainHistory, shortenerName, false)
+	// The two clocks are using the same shortener, so the new clock
+	// can be created directly from the shortened identifiers
+	return newClock(context, cs.C, maintainHistory, shortenerName, false, opts)
 }
 
 // Compare takes another clock and determines if it is Equal, an
@@ -363,7 +841,50 @@ func (vc *VClock) compare(other *VClock, cond condition) (bool, error) {
 		return false, err
 	}
 
-	return attemptSendChanWithResp[*respComp, bool](vc.req, &respComp{other: m, cond: cond}, vc.resp, errClosedVClock)
+	return attemptSendWithResp[*respComp, bool](vc.backend, &respComp{other: m, cond: cond, mode: vc.compareMode})
+}
+
+// Compare determines the relationship of the other clock to this clock instance
+// in a single evaluation, so that the result is consistent even whilst either clock
+// is being updated concurrently.  The result is expressed from the perspective of
+// this clock; i.e. Descendant is returned where DescendsFrom would return true,
+// and Ancestor where AncestorOf would return true.
+func (vc *VClock) Compare(other *VClock) (Ordering, error) {
+	return vc.CompareWithMode(other, vc.compareMode)
+}
+
+// CompareWithMode determines the relationship of the other clock to this clock
+// instance in the same manner as Compare, but using the specified CompareMode
+// rather than the mode of this clock instance.
+func (vc *VClock) CompareWithMode(other *VClock, mode CompareMode) (Ordering, error) {
+	if other == nil {
+		return 0, errClockMustNotBeNil
+	}
+
+	m, err := other.GetClock()
+	if err != nil {
+		return 0, err
+	}
+
+	return attemptSendWithResp[*reqOrdering, Ordering](vc.backend, &reqOrdering{other: m, mode: mode})
+}
+
+// CompareOn determines the relationship of the other clock to this clock instance
+// in the same manner as Compare, but considering only the specified identifiers.
+func (vc *VClock) CompareOn(other *VClock, ids []string) (Ordering, error) {
+	if other == nil {
+		return 0, errClockMustNotBeNil
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+
+	m, err := other.GetClock()
+	if err != nil {
+		return 0, err
+	}
+
+	return attemptSendWithResp[*reqOrdering, Ordering](vc.backend, &reqOrdering{other: m.Project(ids), mode: vc.compareMode, ids: ids})
 }
 
 // Equal returns true if the contents of the other clock
@@ -373,8 +894,8 @@ func (vc *VClock) Equal(other *VClock) (bool, error) {
 }
 
 // Concurrent returns true if the contents of the other clock
-// are either completely or partially distinct.  Where partially
-// distinct, matching identifiers in the clocks must have the same value.
+// are either completely or partially distinct, such that neither
+// clock can have descended from the other.
 func (vc *VClock) Concurrent(other *VClock) (bool, error) {
 	return vc.compare(other, concurrent)
 }
@@ -403,15 +924,257 @@ func getDefaultShortenerName() string {
 	return "NoOp"
 }
 
+// clockState holds the history of a VClock, and applies each request to it.
+// Access to clockState is serialised by the backend of the VClock.
+type clockState struct {
+	history         *history
+	shortener       IdentifierShortener
+	maintainHistory bool
+}
+
+// apply extends the history with the event, discarding earlier
+// history if it is not being maintained
+func (s *clockState) apply(event *Event) error {
+	if err := s.history.apply(event); err != nil {
+		return err
+	}
+	if !s.maintainHistory {
+		s.history.prune()
+	}
+	return nil
+}
+
+// isReadOnly returns true if processing the request does not modify the clockState
+func isReadOnly(r any) bool {
+	switch r.(type) {
+	case *respComp, *reqOrdering, *reqDiff, *reqLag, *reqFullHistory, *reqGet, *reqHistory, *reqHistoryInfo, *reqHistoryRange, *reqFullHistoryRange, *reqQueryHistory, *reqClockAt, *reqClockAtId, *reqFork, *reqLastUpdate, *reqRetired, *reqSnap, *reqSnapShortenedIdentifiers:
+		return true
+	}
+	return false
+}
+
+// process applies the request to the clockState, returning the response
+func (s *clockState) process(r any) any {
+	switch t := r.(type) {
+	case *respComp:
+		{
+			return compareWithMode(s.history.latest(), s.history.shortenForCompare(t.other), t.cond, t.mode)
+		}
+	case *reqOrdering:
+		{
+			c := s.history.latest()
+			if t.ids != nil {
+				shortIds := make([]string, len(t.ids))
+				for i, id := range t.ids {
+					shortIds[i] = s.shortener.Shorten(id)
+				}
+				c = c.Project(shortIds)
+			}
+			return orderingWithMode(c, s.history.shortenForCompare(t.other), t.mode)
+		}
+	case *reqDiff:
+		{
+			c, err := s.history.latestWithCopy(false)
+			if err != nil {
+				return &respDiff{e: err}
+			}
+			other := copyMap(t.other)
+			for id := range other {
+				if s.history.isRetired(id) {
+					delete(other, id)
+				}
+			}
+			return &respDiff{d: diff(c, other)}
+		}
+	case *reqLag:
+		{
+			d := lag(s.history.latest(), s.history.shortenForCompare(t.other))
+
+			var err error
+			if d.Behind, err = copyMapWithKeyModification(d.Behind, s.shortener.Recover); err != nil {
+				return &respLag{e: err}
+			}
+			if d.Ahead, err = copyMapWithKeyModification(d.Ahead, s.shortener.Recover); err != nil {
+				return &respLag{e: err}
+			}
+			return &respLag{d: d}
+		}
+	case *reqFullHistory:
+		{
+			h, err := s.history.getFullAll()
+			return &respHistoryAll{h: h, e: err}
+		}
+	case *reqGet:
+		{
+			vc := s.history.latest()
+
+			val, ok := vc[s.shortener.Shorten(t.id)]
+			g := &respGetterWithStatus{b: ok}
+			g.id = t.id
+			g.v = val
+			return g
+		}
+	case *reqHistory:
+		{
+			h, err := s.history.getAll()
+			return &respHistory{h: h, e: err}
+		}
+	case *reqHistoryRange:
+		{
+			h, err := s.history.getRange(t.from, t.to, false)
+			return &respHistory{h: h, e: err}
+		}
+	case *reqFullHistoryRange:
+		{
+			h, err := s.history.getFullRange(t.from, t.to, false)
+			return &respHistoryAll{h: h, e: err}
+		}
+	case *reqClockAt:
+		{
+			c, err := s.history.getAt(t.t)
+			return &respClock{c: c, e: err}
+		}
+	case *reqFork:
+		{
+			items, retired, err := s.history.getFork(t.id, t.keepHistory)
+			return &respFork{items: items, retired: retired, e: err}
+		}
+	case *reqClockAtId:
+		{
+			c, err := s.history.getAtId(t.id)
+			return &respClock{c: c, e: err}
+		}
+	case *reqQueryHistory:
+		{
+			h, err := s.history.query(&t.q)
+			return &respHistoryAll{h: h, e: err}
+		}
+	case *reqHistoryInfo:
+		{
+			return &respHistoryInfo{
+				first: s.history.getFirstId(),
+				last:  s.history.getLastId(),
+				n:     len(s.history.items),
+			}
+		}
+	case *reqLastUpdate:
+		{
+			vc := s.history.latest()
+
+			var id string = ""
+			var last uint64
+			for key := range vc {
+				if vc[key] > last {
+					id = key
+					last = vc[key]
+				}
+			}
+			id, err := s.shortener.Recover(id)
+			return &respGetter{id: id, v: last, e: err}
+		}
+	case *reqPrune:
+		{
+			s.history.prune()
+			return &respErr{err: nil}
+		}
+	case *reqSet:
+		{
+			return &respErr{err: s.apply(&Event{Type: Set, Set: t.s, Metadata: t.md})}
+		}
+	case *reqMerge:
+		{
+			return &respErr{err: s.apply(&Event{Type: Merge, Merge: t.c, Metadata: t.md})}
+		}
+	case *reqReceive:
+		{
+			if err := s.apply(&Event{Type: Receive, Tick: t.id, Merge: t.remote}); err != nil {
+				return &respClock{e: err}
+			}
+			c, err := s.history.latestWithCopy(false)
+			return &respClock{c: c, e: err}
+		}
+	case *reqUpdate:
+		{
+			tx := &Tx{
+				c:      copyMap(s.history.latest()),
+				f:      s.shortener.Shorten,
+				filter: s.history.withoutRetired,
+			}
+			if err := t.fn(tx); err != nil {
+				return &respErr{err: err}
+			}
+			if tx.err != nil {
+				return &respErr{err: tx.err}
+			}
+			if len(tx.events) == 0 {
+				return &respErr{err: nil}
+			}
+			return &respErr{err: s.apply(&Event{Type: Transaction, Events: tx.events})}
+		}
+	case *reqSetMax:
+		{
+			return &respErr{err: s.apply(&Event{Type: SetMax, Set: &SetInfo{Id: t.id, Value: t.v}})}
+		}
+	case *reqAdvance:
+		{
+			return &respErr{err: s.apply(&Event{Type: Advance, Set: &SetInfo{Id: t.id, Value: t.n}})}
+		}
+	case *reqRetire:
+		{
+			return &respErr{err: s.apply(&Event{Type: Retire, Retire: t.id})}
+		}
+	case *reqRetired:
+		{
+			c, err := s.history.getRetired()
+			return &respClock{c: c, e: err}
+		}
+	case *reqSnap:
+		{
+			c, err := s.history.latestWithCopy(false)
+			return &respClock{c: c, e: err}
+		}
+	case *reqSnapShortenedIdentifiers:
+		{
+			c, err := s.history.latestWithCopy(true)
+			return &respClock{c: c, e: err}
+		}
+	case *reqTick:
+		{
+			if len(t.id) == 0 {
+				return &respErr{err: errClockIdMustNotBeEmptyString}
+			}
+			return &respErr{err: s.apply(&Event{Type: Tick, Tick: t.id, Metadata: t.md})}
+		}
+	case *reqTickAndSnap:
+		{
+			if len(t.id) == 0 {
+				return &respClock{e: errClockIdMustNotBeEmptyString}
+			}
+			if err := s.apply(&Event{Type: Tick, Tick: t.id}); err != nil {
+				return &respClock{e: err}
+			}
+			c, err := s.history.latestWithCopy(t.shortened)
+			return &respClock{c: c, e: err}
+		}
+	}
+	return &respErr{err: errUnknownReqType}
+}
+
 // newClock starts a new clock, with or without history
-func newClock(ctx context.Context, init Clock, maintainHistory bool, shortenerName string, applyShortenerToInit bool) (*VClock, error) {
+func newClock(ctx context.Context, init Clock, maintainHistory bool, shortenerName string, applyShortenerToInit bool, opts []Option) (*VClock, error) {
+	v, state, o := newClockState(ctx, init, maintainHistory, shortenerName, applyShortenerToInit, opts)
+	v.start(state, o.backend)
+	return v, nil
+}
+
+// newClockState prepares a clock and its state, without starting the backend
+func newClockState(ctx context.Context, init Clock, maintainHistory bool, shortenerName string, applyShortenerToInit bool, opts []Option) (*VClock, *clockState, *options) {
 
 	ctx, cancel := context.WithCancel(ctx)
 
 	v := &VClock{
-		req:       chant.New[any](),
-		resp:      chant.New[any](),
 		shortener: shortenerName,
+		opts:      opts,
 		ctx:       ctx,
 		cancel:    cancel,
 	}
@@ -421,129 +1184,35 @@ func newClock(ctx context.Context, init Clock, maintainHistory bool, shortenerNa
 	}
 	shortener, _ := GetShortenerFactory().Get(v.shortener)
 
-	waiter := make(chan bool)
-
-	go func() {
-
-		defer func() {
-			v.req.Close()
-			v.resp.Close()
-		}()
-
-		noErr := &respErr{err: nil}
-
-		c := Clock{}
-		if init != nil {
-			keys := syncmap.SortedKeys(init)
-			for _, key := range keys {
-				c[key] = init[key]
-			}
+	c := Clock{}
+	if init != nil {
+		keys := syncmap.SortedKeys(init)
+		for _, key := range keys {
+			c[key] = init[key]
 		}
+	}
 
-		history := newHistory(c, shortener, applyShortenerToInit)
-
-		processRequest := func(r any) {
-
-			if !maintainHistory {
-				// Prune if history not being maintained
-				history = newHistory(history.latest(), shortener, false)
-			}
-
-			switch t := r.(type) {
-			case *respComp:
-				{
-					f := func(s string) (string, error) { return shortener.Shorten(s), nil }
-					c, _ := copyMapWithKeyModification(t.other, f)
-					v.resp.Send(compare(history.latest(), c, t.cond))
-				}
-			case *reqFullHistory:
-				{
-					h, err := history.getFullAll()
-					v.resp.Send(&respHistoryAll{h: h, e: err})
-				}
-			case *reqGet:
-				{
-					vc := history.latest()
-
-					val, ok := vc[shortener.Shorten(t.id)]
-					g := &respGetterWithStatus{b: ok}
-					g.id = t.id
-					g.v = val
-					v.resp.Send(g)
-				}
-			case *reqHistory:
-				{
-					h, err := history.getAll()
-					v.resp.Send(&respHistory{h: h, e: err})
-				}
-			case *reqLastUpdate:
-				{
-					vc := history.latest()
-
-					var id string = ""
-					var last uint64
-					for key := range vc {
-						if vc[key] > last {
-							id = key
-							last = vc[key]
-						}
-					}
-					id, err := shortener.Recover(id)
-					v.resp.Send(&respGetter{id: id, v: last, e: err})
-				}
-			case Clock:
-				{
-					v.resp.Send(&respErr{err: history.apply(&Event{Type: Merge, Merge: t})})
-				}
-			case *reqPrune:
-				{
-					history = newHistory(history.latest(), shortener, false)
-					v.resp.Send(noErr)
-				}
-			case *SetInfo:
-				{
-					v.resp.Send(&respErr{err: history.apply(&Event{Type: Set, Set: t})})
-				}
-			case *reqSnap:
-				{
-					c, err := history.latestWithCopy(false)
-					v.resp.Send(&respClock{c: c, e: err})
-				}
-			case *reqSnapShortenedIdentifiers:
-				{
-					c, err := history.latestWithCopy(true)
-					v.resp.Send(&respClock{c: c, e: err})
-				}
-			case *reqTick:
-				{
-					if len(t.id) == 0 {
-						v.resp.Send(&respErr{err: errClockIdMustNotBeEmptyString})
-					} else {
-						v.resp.Send(&respErr{err: history.apply(&Event{Type: Tick, Tick: t.id})})
-					}
-				}
-			default:
-				v.resp.Send(&respErr{err: errUnknownReqType})
-			}
-		}
-
-		// Signal ready
-		waiter <- true
-
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case r := <-v.req.RawChan():
-				processRequest(r)
-			}
-		}
+	o := newOptions(opts)
+	v.compareMode = o.compareMode
 
-	}()
+	state := &clockState{
+		history:         newHistory(c, shortener, applyShortenerToInit, o.now),
+		shortener:       shortener,
+		maintainHistory: maintainHistory,
+	}
+	if maintainHistory {
+		state.history.retention = o.retention
+	}
 
-	// Wait until ready
-	<-waiter
-	close(waiter)
+	return v, state, o
+}
 
-	return v, nil
+// start begins processing requests against the state, using the specified backend
+func (vc *VClock) start(state *clockState, backend Backend) {
+	switch backend {
+	case MutexBackend:
+		vc.backend = newMutexBackend(vc.ctx, state)
+	default:
+		vc.backend = newChannelBackend(vc.ctx, state)
+	}
 }
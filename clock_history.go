@@ -1,5 +1,39 @@
 package vclock
 
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var errHistoryNotAvailable = errors.New("history is not available for the requested point")
+var errHistoryMustNotBeEmpty = errors.New("history must contain at least one item")
+var errHistoryItemMustNotBeNil = errors.New("history must not contain nil items")
+var errHistoryIdNotContiguous = errors.New("history ids must be contiguous")
+var errHistoryChangeMustNotBeNil = errors.New("history item must have a change to replay")
+
+// HistoryDivergenceError describes the first HistoryItem where replaying
+// the history did not reproduce the recorded Clock.  Err is set if the
+// item could not be replayed at all.
+type HistoryDivergenceError struct {
+	HistoryId uint64
+	Expected  Clock
+	Actual    Clock
+	Err       error
+}
+
+func (e *HistoryDivergenceError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("history diverges at %d: %v", e.HistoryId, e.Err)
+	}
+	return fmt.Sprintf("history diverges at %d: expected %v, got %v", e.HistoryId, e.Expected, e.Actual)
+}
+
+func (e *HistoryDivergenceError) Unwrap() error {
+	return e.Err
+}
+
 // copyMap returns a copy of the supplied instance (non-deep)
 func copyMap[T comparable, U any](m map[T]U) map[T]U {
 	newm := map[T]U{}
@@ -23,12 +57,42 @@ func copyMapWithKeyModification[T comparable, U any](m map[T]U, f func(T) (T, er
 }
 
 // history records all historic events (subject to pruning)
-// all HistoryItems contain Clocks with shortened identifiers,
-// which are created during the apply().
+// all Clocks use shortened identifiers, and are created during the apply().
+// To limit memory use, only checkpoint HistoryItems hold a Clock, with the
+// Clocks of the other items reconstructed on demand by applying their Events
+// to the preceding checkpoint.  The first item is always a checkpoint, and
+// the current Clock is held separately.
+// Retired identifiers are held as tombstones (again as shortened identifiers)
+// with their final value, which are retained when the history is pruned.
+// The tombstones as they were at the first item are also held, so that those
+// at any available item can be determined.
+// HistoryIds are never reused, so once pruned the first item is the
+// earliest available HistoryId.
 type history struct {
-	lastId    uint64
-	items     []*HistoryItem
-	shortener IdentifierShortener
+	lastId       uint64
+	items        []*HistoryItem
+	current      Clock
+	size         int
+	shortener    IdentifierShortener
+	retired      Clock
+	firstRetired Clock
+	retention    retention
+	now          func() time.Time
+	wal          *wal
+}
+
+// checkpointInterval determines how frequently (by HistoryId) an item
+// holds a copy of the Clock, bounding the number of Events to be applied
+// when reconstructing the Clock of any item
+const checkpointInterval = 64
+
+// retention defines the limits applied to the history by apply(),
+// where zero values indicate the limit does not apply
+type retention struct {
+	maxItems int
+	maxAge   time.Duration
+	maxBytes int
+	onPruned func(from, to uint64)
 }
 
 // apply attempts to extend the history by applying the event
@@ -38,6 +102,7 @@ func (h *history) apply(event *Event) error {
 		return err
 	}
 
+	event = h.withoutRetired(event)
 	if err := event.apply(vc, h.shortener.Shorten); err != nil {
 		return err
 	}
@@ -47,18 +112,342 @@ func (h *history) apply(event *Event) error {
 	item := &HistoryItem{
 		HistoryId: nextId,
 		Change:    event,
-		Clock:     vc,
+		Time:      h.now(),
 	}
 
+	// The update is only applied once it is durable
+	if h.wal != nil {
+		if err := h.wal.append(&walRecord{HistoryId: item.HistoryId, Time: item.Time, Change: event}); err != nil {
+			return err
+		}
+	}
+	h.updateRetired(event, h.latest())
+
+	// The current Clock is never altered in place, so can be shared by a checkpoint
+	if nextId%checkpointInterval == 0 {
+		item.Clock = vc
+	}
+
+	h.current = vc
 	h.items = append(h.items, item)
+	h.size += item.approxSize()
 	h.lastId = nextId
+
+	h.enforceRetention()
+	return nil
+}
+
+// replay applies the Change of each item after the first, which is assumed to
+// have provided the initial Clock, retaining the HistoryId and time of each item.
+// The resulting Clocks are verified against those recorded in the items.
+func (h *history) replay(items []*HistoryItem) error {
+	if items[0].Change != nil {
+		if err := items[0].Change.validate(); err != nil {
+			return &HistoryDivergenceError{HistoryId: items[0].HistoryId, Expected: copyMap(items[0].Clock), Err: err}
+		}
+	}
+	h.restart(items[0].HistoryId, items[0].Time, items[0].Change)
+
+	now := h.now
+	defer func() { h.now = now }()
+
+	for _, item := range items[1:] {
+		diverged := func(err error) error {
+			return &HistoryDivergenceError{HistoryId: item.HistoryId, Expected: copyMap(item.Clock), Err: err}
+		}
+
+		if item.HistoryId != h.lastId+1 {
+			return diverged(errHistoryIdNotContiguous)
+		}
+		if item.Change == nil {
+			return diverged(errHistoryChangeMustNotBeNil)
+		}
+		if err := item.Change.validate(); err != nil {
+			return diverged(err)
+		}
+
+		t := item.Time
+		h.now = func() time.Time { return t }
+
+		if err := h.apply(item.Change.copy()); err != nil {
+			return diverged(err)
+		}
+
+		c, err := copyMapWithKeyModification(h.latest(), h.shortener.Recover)
+		if err != nil {
+			return diverged(err)
+		}
+		if !clocksEqual(c, item.Clock) {
+			return &HistoryDivergenceError{HistoryId: item.HistoryId, Expected: copyMap(item.Clock), Actual: c}
+		}
+	}
 	return nil
 }
 
+// recover applies the Change of each of the records from the write-ahead log after the
+// first, which is assumed to have provided the initial Clock, retaining the HistoryId
+// and time of each record.
+func (h *history) recover(records []*walRecord) error {
+	h.restart(records[0].HistoryId, records[0].Time, nil)
+
+	now := h.now
+	defer func() { h.now = now }()
+
+	for _, rec := range records[1:] {
+		if rec.HistoryId != h.lastId+1 || rec.Change == nil {
+			return errWALInvalidSequence
+		}
+		if err := rec.Change.validate(); err != nil {
+			return err
+		}
+
+		t := rec.Time
+		h.now = func() time.Time { return t }
+
+		if err := h.apply(rec.Change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restart assigns the HistoryId, time and Change of the initial item
+func (h *history) restart(id uint64, t time.Time, change *Event) {
+	first := h.items[0]
+	first.HistoryId = id
+	first.Time = t
+	if change != nil {
+		first.Change = change.copy()
+		h.size = first.approxSize()
+	}
+	h.lastId = id
+}
+
+// clocksEqual returns true if both clocks have the same identifiers and values
+func clocksEqual(a, b Clock) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for id, v := range a {
+		if w, ok := b[id]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+// enforceRetention discards the earliest items that exceed any of the retention
+// limits, always retaining the latest item
+func (h *history) enforceRetention() {
+	r := h.retention
+
+	exceeded := func(n int) bool {
+		return (r.maxItems > 0 && len(h.items)-n > r.maxItems) ||
+			(r.maxAge > 0 && h.now().Sub(h.items[n].Time) > r.maxAge) ||
+			(r.maxBytes > 0 && h.size > r.maxBytes)
+	}
+
+	n := 0
+	for n < len(h.items)-1 && exceeded(n) {
+		h.size -= h.items[n].approxSize()
+		n++
+	}
+	h.discard(n)
+}
+
+// discard removes the first n items, reporting the range of HistoryIds removed
+func (h *history) discard(n int) {
+	if n == 0 {
+		return
+	}
+
+	from, to := h.getFirstId(), h.items[n-1].HistoryId
+
+	// Advance the tombstones to those at the first remaining item
+	for i := 1; i <= n; i++ {
+		h.updateTombstones(h.firstRetired, h.items[i].Change, func() Clock { return h.clockAt(i - 1) })
+	}
+
+	// The first remaining item must become a checkpoint, which can share
+	// the current Clock if it is the latest item
+	if h.items[n].Clock == nil {
+		if n == len(h.items)-1 {
+			h.items[n].Clock = h.current
+		} else {
+			h.items[n].Clock = h.clockAt(n)
+		}
+		h.size += clockSize(h.items[n].Clock)
+	}
+
+	// Release the discarded items before reslicing
+	for i := 0; i < n; i++ {
+		h.items[i] = nil
+	}
+	h.items = h.items[n:]
+
+	if h.retention.onPruned != nil {
+		h.retention.onPruned(from, to)
+	}
+}
+
+// isRetired returns true if the (unshortened) identifier has been retired
+func (h *history) isRetired(id string) bool {
+	_, ok := h.retired[h.shortener.Shorten(id)]
+	return ok
+}
+
+// withoutRetired removes any retired identifiers from clocks
+// being merged by the event, so that they are not reintroduced
+func (h *history) withoutRetired(event *Event) *Event {
+	if len(h.retired) == 0 {
+		return event
+	}
+	return event.withoutIds(h.isRetired)
+}
+
+// updateRetired maintains the tombstones following the successful application
+// of the event, with the prior clock value providing the final value of retired identifiers.
+// Setting a retired identifier, with Set or SetMax, reintroduces it to the clock.
+func (h *history) updateRetired(event *Event, prior Clock) {
+	h.updateTombstones(h.retired, event, func() Clock { return prior })
+}
+
+// updateTombstones applies the event to the tombstones, with the prior clock value
+// only being determined if required to provide the final value of a retired identifier
+func (h *history) updateTombstones(tombstones Clock, event *Event, prior func() Clock) {
+	switch event.Type {
+	case Set, SetMax:
+		delete(tombstones, h.shortener.Shorten(event.Set.Id))
+	case Retire:
+		id := h.shortener.Shorten(event.Retire)
+		tombstones[id] = prior()[id]
+	case Transaction:
+		var c Clock
+		once := func() Clock {
+			if c == nil {
+				c = prior()
+			}
+			return c
+		}
+		for _, ev := range event.Events {
+			h.updateTombstones(tombstones, ev, once)
+		}
+	}
+}
+
+// retiredAt returns a copy of the tombstones as they were at the item
+// with the specified index
+func (h *history) retiredAt(i int) Clock {
+	r := copyMap(h.firstRetired)
+	for k := 1; k <= i; k++ {
+		h.updateTombstones(r, h.items[k].Change, func() Clock { return h.clockAt(k - 1) })
+	}
+	return r
+}
+
+// setRetired replaces the tombstones, both current and at the first item,
+// with those provided using the fully expanded identifiers
+func (h *history) setRetired(retired Clock) {
+	f := func(s string) (string, error) { return h.shortener.Shorten(s), nil }
+	h.retired, _ = copyMapWithKeyModification(retired, f)
+	h.firstRetired = copyMap(h.retired)
+}
+
+// getFork returns the items and tombstones from which a clock can be forked at the
+// specified HistoryId, using the fully expanded identifiers.  If the history is to be
+// kept, all available items up to the HistoryId are returned with the tombstones at the
+// first of these, otherwise only the item at the HistoryId and its tombstones are returned.
+func (h *history) getFork(id uint64, keepHistory bool) ([]*HistoryItem, Clock, error) {
+	if id < h.getFirstId() || id > h.getLastId() {
+		return nil, nil, errHistoryNotAvailable
+	}
+
+	from, retired := h.getFirstId(), h.firstRetired
+	if !keepHistory {
+		from, retired = id, h.retiredAt(int(id-h.getFirstId()))
+	}
+
+	items, err := h.getFullRange(from, id, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	r, err := copyMapWithKeyModification(retired, h.shortener.Recover)
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, r, nil
+}
+
+// shortenForCompare returns a copy of the other clock, using shortened identifiers
+// and without any retired identifiers, so that it can be compared to the latest clock
+func (h *history) shortenForCompare(other Clock) Clock {
+	c := Clock{}
+	for id, v := range other {
+		sid := h.shortener.Shorten(id)
+		if _, ok := h.retired[sid]; !ok {
+			c[sid] = v
+		}
+	}
+	return c
+}
+
+// getRetired returns the tombstones of the retired identifiers,
+// using the fully expanded identifiers
+func (h *history) getRetired() (Clock, error) {
+	return copyMapWithKeyModification[string, uint64](h.retired, h.shortener.Recover)
+}
+
+// prune discards all but the latest clock value, retaining the tombstones
+func (h *history) prune() {
+	h.discard(len(h.items) - 1)
+	h.size = h.items[0].approxSize()
+}
+
 // latest returns the current clock value unaltered
 // i.e. always with the shortened identifiers
 func (h *history) latest() Clock {
-	return h.items[h.getLastId()].Clock
+	return h.current
+}
+
+// clockAt reconstructs the clock of the item at the specified index,
+// returning a copy with the shortened identifiers
+func (h *history) clockAt(i int) Clock {
+	var c Clock
+	h.walk(i, i+1, func(_ *HistoryItem, m Clock) error {
+		c = copyMap(m)
+		return nil
+	})
+	return c
+}
+
+// walk calls the function for each item within the specified indices, together with
+// the clock of the item, reconstructed from the nearest preceding checkpoint.
+// The clock is reused between calls, so must be copied if it is to be retained.
+func (h *history) walk(start, end int, fn func(item *HistoryItem, c Clock) error) error {
+	if start >= end {
+		return nil
+	}
+
+	i := start
+	for h.items[i].Clock == nil {
+		i--
+	}
+
+	var c Clock
+	for ; i < end; i++ {
+		if h.items[i].Clock != nil {
+			c = copyMap(h.items[i].Clock)
+		} else {
+			// Events are recorded after they have been successfully applied, so cannot fail
+			h.items[i].Change.apply(c, h.shortener.Shorten)
+		}
+		if i >= start {
+			if err := fn(h.items[i], c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
 
 // latestWithCopy returns a copy of the current clock value,
@@ -75,24 +464,47 @@ func (h *history) getLastId() uint64 {
 	return h.lastId
 }
 
-// getRange returns the specified range of history
-func (h *history) getRange(from, to uint64, useShortened bool) ([]Clock, error) {
+// getFirstId returns the id of the earliest available clock
+func (h *history) getFirstId() uint64 {
+	return h.items[0].HistoryId
+}
+
+// indexRange returns the indices of items within the specified range of
+// HistoryIds, limited to those that are available
+func (h *history) indexRange(from, to uint64) (int, int) {
+	if from > to {
+		from, to = to, from
+	}
+	if from < h.getFirstId() {
+		from = h.getFirstId()
+	}
+	if to > h.getLastId() {
+		to = h.getLastId()
+	}
 	if from > to {
-		return h.getRange(to, from, useShortened)
+		return 0, 0
 	}
+	return int(from - h.getFirstId()), int(to-h.getFirstId()) + 1
+}
+
+// getRange returns the specified range of history
+func (h *history) getRange(from, to uint64, useShortened bool) ([]Clock, error) {
+	start, end := h.indexRange(from, to)
 	ret := []Clock{}
-	for i := from; i <= to; i++ {
-		if i <= h.getLastId() {
-			if useShortened {
-				ret = append(ret, copyMap(h.items[i].Clock))
-			} else {
-				m, err := copyMapWithKeyModification(h.items[i].Clock, h.shortener.Recover)
-				if err != nil {
-					return nil, err
-				}
-				ret = append(ret, m)
-			}
+	err := h.walk(start, end, func(_ *HistoryItem, c Clock) error {
+		if useShortened {
+			ret = append(ret, copyMap(c))
+			return nil
+		}
+		m, err := copyMapWithKeyModification(c, h.shortener.Recover)
+		if err != nil {
+			return err
 		}
+		ret = append(ret, m)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return ret, nil
 }
@@ -100,43 +512,137 @@ func (h *history) getRange(from, to uint64, useShortened bool) ([]Clock, error)
 // getAll returns all of the history using the
 // fully expanded identifiers
 func (h *history) getAll() ([]Clock, error) {
-	return h.getRange(0, h.getLastId(), false)
+	return h.getRange(h.getFirstId(), h.getLastId(), false)
 }
 
 // getFullRange returns the specified range of history
 func (h *history) getFullRange(from, to uint64, useShortened bool) ([]*HistoryItem, error) {
-	if from > to {
-		return h.getFullRange(to, from, useShortened)
+	start, end := h.indexRange(from, to)
+	ret := []*HistoryItem{}
+	err := h.walk(start, end, func(item *HistoryItem, c Clock) error {
+		if useShortened {
+			ret = append(ret, item.withClock(c).copy())
+			return nil
+		}
+		hi, err := item.withClock(c).copyWithKeyModification(h.shortener.Recover)
+		if err != nil {
+			return err
+		}
+		ret = append(ret, hi)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// HistoryQuery specifies the filters to be applied by QueryHistory.
+// An item must satisfy all of the filters to be returned, with the zero
+// value of each filter having no effect.
+type HistoryQuery struct {
+	Types    EventType // Bit mask of the EventTypes to include, matched against the type of each Event
+	Ids      []string  // Identifiers, at least one of which must be referred to by the Event
+	FromId   uint64    // The earliest HistoryId to include
+	ToId     uint64    // The latest HistoryId to include, with zero indicating the latest item
+	FromTime time.Time // The earliest time of application to include
+	ToTime   time.Time // The latest time of application to include
+}
+
+// matches returns true if the item satisfies the type and identifier filters.
+// The initial item, which has no Event, only matches if neither filter is specified.
+func (q *HistoryQuery) matches(item *HistoryItem) bool {
+	if !q.FromTime.IsZero() && item.Time.Before(q.FromTime) {
+		return false
+	}
+	if !q.ToTime.IsZero() && item.Time.After(q.ToTime) {
+		return false
 	}
+	if q.Types == 0 && len(q.Ids) == 0 {
+		return true
+	}
+	if item.Change == nil {
+		return false
+	}
+	if q.Types != 0 && q.Types&item.Change.Type == 0 {
+		return false
+	}
+	if len(q.Ids) == 0 {
+		return true
+	}
+	for _, id := range q.Ids {
+		if item.Change.touches(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// query returns the items satisfying the query, using the fully expanded identifiers.
+// Only matching items are copied.
+func (h *history) query(q *HistoryQuery) ([]*HistoryItem, error) {
+	to := q.ToId
+	if to == 0 {
+		to = h.getLastId()
+	}
+	if q.FromId > to {
+		return []*HistoryItem{}, nil
+	}
+
+	start, end := h.indexRange(q.FromId, to)
 	ret := []*HistoryItem{}
-	for i := from; i <= to; i++ {
-		if i <= h.getLastId() {
-			if useShortened {
-				ret = append(ret, h.items[i].copy())
-			} else {
-				item, err := h.items[i].copyWithKeyModification(h.shortener.Recover)
-				if err != nil {
-					return nil, err
-				}
-				ret = append(ret, item)
-			}
+	err := h.walk(start, end, func(item *HistoryItem, c Clock) error {
+		if !q.matches(item) {
+			return nil
+		}
+		hi, err := item.withClock(c).copyWithKeyModification(h.shortener.Recover)
+		if err != nil {
+			return err
 		}
+		ret = append(ret, hi)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return ret, nil
 }
 
+// getAt returns the latest clock applied at or before the specified time, using
+// the fully expanded identifiers.  An error is returned if no such clock is available.
+func (h *history) getAt(t time.Time) (Clock, error) {
+	i := sort.Search(len(h.items), func(i int) bool { return h.items[i].Time.After(t) })
+	if i == 0 {
+		return nil, errHistoryNotAvailable
+	}
+	return copyMapWithKeyModification(h.clockAt(i-1), h.shortener.Recover)
+}
+
+// getAtId returns the clock of the item with the specified HistoryId, using the
+// fully expanded identifiers.  An error is returned if the item is not available.
+func (h *history) getAtId(id uint64) (Clock, error) {
+	if id < h.getFirstId() || id > h.getLastId() {
+		return nil, errHistoryNotAvailable
+	}
+	return copyMapWithKeyModification(h.clockAt(int(id-h.getFirstId())), h.shortener.Recover)
+}
+
 // getFullAll returns all of the history using the
 // fully expanded identifiers
 func (h *history) getFullAll() ([]*HistoryItem, error) {
-	return h.getFullRange(0, h.getLastId(), false)
+	return h.getFullRange(h.getFirstId(), h.getLastId(), false)
 }
 
-// newHistory initialises an instance of history
-func newHistory(m Clock, shortener IdentifierShortener, applyShortener bool) *history {
+// newHistory initialises an instance of history, using the time source
+// to timestamp each item
+func newHistory(m Clock, shortener IdentifierShortener, applyShortener bool, now func() time.Time) *history {
 	h := &history{
-		lastId:    0,
-		items:     []*HistoryItem{},
-		shortener: shortener,
+		lastId:       0,
+		items:        []*HistoryItem{},
+		shortener:    shortener,
+		retired:      Clock{},
+		firstRetired: Clock{},
+		now:          now,
 	}
 
 	var c Clock
@@ -151,7 +657,10 @@ func newHistory(m Clock, shortener IdentifierShortener, applyShortener bool) *hi
 		HistoryId: 0,
 		Change:    nil,
 		Clock:     c,
+		Time:      h.now(),
 	})
+	h.current = c
+	h.size = h.items[0].approxSize()
 
 	return h
 }
@@ -0,0 +1,141 @@
+package vclock
+
+// identity leaves identifiers unaltered when applying Events to a Clock
+func identity(s string) string {
+	return s
+}
+
+// Copy returns a copy of the Clock
+func (c Clock) Copy() Clock {
+	return copyMap(c)
+}
+
+// Get returns the value for the specified identifier,
+// returning true if the identifier is found, otherwise false
+func (c Clock) Get(id string) (uint64, bool) {
+	v, ok := c[id]
+	return v, ok
+}
+
+// Set assigns the specified value to the given identifier, with the
+// same rules as VClock.Set.  The Clock must not be nil.
+func (c Clock) Set(id string, v uint64) error {
+	return (&Event{Type: Set, Set: &SetInfo{Id: id, Value: v}}).apply(c, identity)
+}
+
+// SetMax assigns the value to the given identifier if absent or lower, with
+// the same rules as VClock.SetMax.  The Clock must not be nil.
+func (c Clock) SetMax(id string, v uint64) error {
+	return (&Event{Type: SetMax, Set: &SetInfo{Id: id, Value: v}}).apply(c, identity)
+}
+
+// Advance adds n to the value of the specified identifier, with the
+// same rules as VClock.Advance.  The Clock must not be nil.
+func (c Clock) Advance(id string, n uint64) error {
+	return (&Event{Type: Advance, Set: &SetInfo{Id: id, Value: n}}).apply(c, identity)
+}
+
+// Tick increments the value of the specified identifier, with the
+// same rules as VClock.Tick.  The Clock must not be nil.
+func (c Clock) Tick(id string) error {
+	if len(id) == 0 {
+		return errClockIdMustNotBeEmptyString
+	}
+	return (&Event{Type: Tick, Tick: id}).apply(c, identity)
+}
+
+// Merge combines the other Clock into this Clock, taking the
+// maximum value of each identifier.  The Clock must not be nil.
+func (c Clock) Merge(other Clock) {
+	(&Event{Type: Merge, Merge: other}).apply(c, identity)
+}
+
+// Receive merges the remote Clock into this Clock and then increments the
+// local identifier, with the same rules as VClock.Receive.  The Clock must
+// not be nil, and is unaltered if an error is returned.
+func (c Clock) Receive(localId string, remote Clock) error {
+	return (&Event{Type: Receive, Tick: localId, Merge: remote}).apply(c, identity)
+}
+
+// Equal returns true if the other Clock exactly matches this Clock,
+// with the same semantics as VClock.Equal using StrictCompare
+func (c Clock) Equal(other Clock) bool {
+	return ordering(c, other) == Equal
+}
+
+// Concurrent returns true if neither Clock can have descended from the other,
+// with the same semantics as VClock.Concurrent using StrictCompare
+func (c Clock) Concurrent(other Clock) bool {
+	return ordering(c, other) == Concurrent
+}
+
+// DescendsFrom returns true if the other Clock can have descended
+// from this Clock, with the same semantics as VClock.DescendsFrom
+// using StrictCompare
+func (c Clock) DescendsFrom(other Clock) bool {
+	return ordering(c, other) == Descendant
+}
+
+// AncestorOf returns true if this Clock can have descended from
+// the other Clock, with the same semantics as VClock.AncestorOf
+// using StrictCompare
+func (c Clock) AncestorOf(other Clock) bool {
+	return ordering(c, other) == Ancestor
+}
+
+// Dominates returns true if every identifier in the other Clock is present
+// in this Clock with the same or a greater value; i.e. this Clock has seen
+// every event that the other Clock has seen
+func (c Clock) Dominates(other Clock) bool {
+	o := ordering(c, other)
+	return o == Equal || o == Ancestor
+}
+
+// Project returns a copy of the Clock restricted to the specified identifiers,
+// so that comparisons and merges can be limited to a subset of identifiers
+func (c Clock) Project(ids []string) Clock {
+	ret := Clock{}
+	for _, id := range ids {
+		if v, ok := c[id]; ok {
+			ret[id] = v
+		}
+	}
+	return ret
+}
+
+// CompareOn determines the relationship of the other clock to this clock,
+// considering only the specified identifiers
+func (c Clock) CompareOn(other Clock, ids []string) Ordering {
+	return ordering(c.Project(ids), other.Project(ids))
+}
+
+// Join returns the pointwise maximum of the clocks, being the
+// least Clock that dominates all of the clocks
+func Join(clocks ...Clock) Clock {
+	ret := Clock{}
+	for _, c := range clocks {
+		ret.Merge(c)
+	}
+	return ret
+}
+
+// Meet returns the pointwise minimum of the clocks, being the greatest Clock
+// dominated by all of the clocks.  Only identifiers present in every clock
+// are included, as an identifier absent from any clock is considered unseen.
+func Meet(clocks ...Clock) Clock {
+	if len(clocks) == 0 {
+		return Clock{}
+	}
+
+	ret := copyMap(clocks[0])
+	for _, c := range clocks[1:] {
+		for id, v := range ret {
+			if o, ok := c[id]; !ok {
+				delete(ret, id)
+			} else if o < v {
+				ret[id] = o
+			}
+		}
+	}
+	return ret
+}
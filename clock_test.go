@@ -1,9 +1,14 @@
 package vclock
 
 import (
+	"bytes"
 	"context"
+	"encoding/gob"
 	"errors"
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
@@ -1059,8 +1064,9 @@ func TestConcurrent3(t *testing.T) {
 		t.Fatalf("unexpected error %q\n", err.Error())
 	}
 
-	if result {
-		t.Fatal("expected inequality (false) but true returned")
+	// Neither clock can have descended from the other
+	if !result {
+		t.Fatal("expected concurrency (true) but false returned")
 	}
 }
 
@@ -2244,3 +2250,2841 @@ func TestFromBytes4(t *testing.T) {
 	}
 
 }
+
+func TestClockCompare(t *testing.T) {
+
+	tests := []struct {
+		c1, c2 Clock
+		want   Ordering
+	}{
+		{Clock{"a": 1, "b": 14}, Clock{"a": 1, "b": 14}, Equal},
+		{Clock{}, Clock{}, Equal},
+		{Clock{"a": 1, "b": 14}, Clock{"a": 2, "b": 14}, Descendant},
+		{Clock{"a": 1}, Clock{"a": 1, "b": 0}, Descendant},
+		{Clock{"a": 2, "b": 14}, Clock{"a": 1, "b": 14}, Ancestor},
+		{Clock{"a": 1, "b": 0}, Clock{"a": 1}, Ancestor},
+		{Clock{"a": 2, "b": 1}, Clock{"a": 1, "b": 2}, Concurrent},
+		{Clock{"a": 1}, Clock{"b": 1}, Concurrent},
+		{Clock{"a": 1, "b": 1}, Clock{"a": 2, "c": 1}, Concurrent},
+	}
+
+	for i, test := range tests {
+		if got := test.c1.Compare(test.c2); got != test.want {
+			t.Fatalf("%d: expected %v, got %v\n", i, test.want, got)
+		}
+	}
+}
+
+func TestCompare(t *testing.T) {
+
+	ctx := context.Background()
+
+	init1 := Clock{"a": 1, "b": 14}
+	v1, err := New(ctx, init1, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v1.Close()
+
+	init2 := Clock{"a": 1, "b": 14}
+	v2, err := New(ctx, init2, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v2.Close()
+
+	checkClocks := func(v1, v2 *VClock, want Ordering) {
+		result, err := v1.Compare(v2)
+		if err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+		if result != want {
+			t.Fatalf("expected %v but got %v\n", want, result)
+		}
+
+		equal, _ := v1.Equal(v2)
+		if equal != (result == Equal) {
+			t.Fatalf("Compare (%v) is inconsistent with Equal (%v)\n", result, equal)
+		}
+		descends, _ := v1.DescendsFrom(v2)
+		if descends != (result == Descendant) {
+			t.Fatalf("Compare (%v) is inconsistent with DescendsFrom (%v)\n", result, descends)
+		}
+		ancestor, _ := v1.AncestorOf(v2)
+		if ancestor != (result == Ancestor) {
+			t.Fatalf("Compare (%v) is inconsistent with AncestorOf (%v)\n", result, ancestor)
+		}
+		concurrent, _ := v1.Concurrent(v2)
+		if concurrent != (result == Concurrent) {
+			t.Fatalf("Compare (%v) is inconsistent with Concurrent (%v)\n", result, concurrent)
+		}
+	}
+
+	check := func(want Ordering) {
+		checkClocks(v1, v2, want)
+	}
+
+	check(Equal)
+
+	v2.Tick("a")
+	check(Descendant)
+
+	v1.Tick("a")
+	v1.Tick("a")
+	check(Ancestor)
+
+	v2.Tick("b")
+	check(Concurrent)
+
+	// Clocks with differing identifiers, of different lengths
+	v3, err := New(ctx, Clock{"a": 1, "b": 1}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v3.Close()
+
+	v4, err := New(ctx, Clock{"a": 1, "c": 1, "d": 1}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v4.Close()
+
+	checkClocks(v3, v4, Concurrent)
+	checkClocks(v4, v3, Concurrent)
+}
+
+func TestCompareOtherClockNil(t *testing.T) {
+
+	ctx := context.Background()
+
+	v1, err := New(ctx, Clock{"a": 1}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v1.Close()
+
+	_, err = v1.Compare(nil)
+	if err == nil {
+		t.Fatal("expected error but didn't get one")
+	}
+	if err != errClockMustNotBeNil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+}
+
+func TestCompareClockClosed(t *testing.T) {
+
+	ctx := context.Background()
+
+	v1, err := New(ctx, Clock{"a": 1}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	v2, err := New(ctx, Clock{"a": 1}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v2.Close()
+
+	v1.Close()
+
+	// Need this to guarantee test behaviour - need the context cancel()
+	// goroutine to execute so that the vector clock is actually closed
+	time.Sleep(1 * time.Millisecond)
+
+	_, err = v1.Compare(v2)
+	if err == nil {
+		t.Fatal("expected error but didn't get one")
+	}
+	if err != errClosedVClock {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+}
+
+func TestClockSetTick(t *testing.T) {
+
+	c := Clock{"a": 1}
+
+	if err := c.Set("b", 14); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := c.Set("a", 2); err != errAttemptToSetExistingId {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+	if err := c.Set("", 2); err != errClockIdMustNotBeEmptyString {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+
+	if err := c.Tick("a"); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := c.Tick("z"); err != errAttemptToTickUnknownId {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+	if err := c.Tick(""); err != errClockIdMustNotBeEmptyString {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+
+	if v, ok := c.Get("a"); !ok || v != 2 {
+		t.Fatalf("unexpected value for a: %v %v\n", v, ok)
+	}
+
+	if !reflect.DeepEqual(c, Clock{"a": 2, "b": 14}) {
+		t.Fatalf("unexpected clock: %v\n", c)
+	}
+}
+
+func TestClockMergeCopy(t *testing.T) {
+
+	c1 := Clock{"a": 1, "b": 14}
+	c2 := c1.Copy()
+
+	c2.Merge(Clock{"a": 3, "b": 2, "c": 7})
+
+	if !reflect.DeepEqual(c1, Clock{"a": 1, "b": 14}) {
+		t.Fatalf("copy was not independent: %v\n", c1)
+	}
+	if !reflect.DeepEqual(c2, Clock{"a": 3, "b": 14, "c": 7}) {
+		t.Fatalf("unexpected merged clock: %v\n", c2)
+	}
+
+	if !c2.Dominates(c1) {
+		t.Fatal("expected merged clock to dominate original")
+	}
+	if c1.Dominates(c2) {
+		t.Fatal("unexpected domination of merged clock")
+	}
+	if !c1.Dominates(c1.Copy()) {
+		t.Fatal("expected clock to dominate its copy")
+	}
+
+	if !c1.DescendsFrom(c2) || !c2.AncestorOf(c1) {
+		t.Fatal("expected merged clock to be a descendant")
+	}
+	if c1.Equal(c2) || !c1.Equal(c1.Copy()) {
+		t.Fatal("unexpected equality result")
+	}
+	if c1.Concurrent(c2) || !c1.Concurrent(Clock{"a": 0, "b": 15}) {
+		t.Fatal("unexpected concurrency result")
+	}
+}
+
+func TestTickAndGet(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 1, "b": 14}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	m, err := v.TickAndGet("a")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(m, Clock{"a": 2, "b": 14}) {
+		t.Fatalf("unexpected clock: %v\n", m)
+	}
+
+	h, err := v.GetHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if len(h) != 2 {
+		t.Fatalf("expected single history entry for tick, got %v\n", h)
+	}
+
+	if _, err := v.TickAndGet("z"); err != errAttemptToTickUnknownId {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+	if _, err := v.TickAndGet(""); err != errClockIdMustNotBeEmptyString {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+}
+
+func TestTickAndGetAfterClose(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := New(ctx, Clock{"a": 1}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	v.Close()
+
+	// Need this to guarantee test behaviour - need the context cancel()
+	// goroutine to execute so that the vector clock is actually closed
+	time.Sleep(1 * time.Millisecond)
+
+	if _, err := v.TickAndGet("a"); err != errClosedVClock {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+	if _, err := v.TickAndBytes("a"); err != errClosedVClock {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+}
+
+func TestTickAndBytes(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := New(ctx, Clock{"a": 1, "b": 14}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	b, err := v.TickAndBytes("b")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	v2, err := FromBytes(ctx, b, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v2.Close()
+
+	m, err := v2.GetClock()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(m, Clock{"a": 1, "b": 15}) {
+		t.Fatalf("unexpected clock: %v\n", m)
+	}
+
+	if _, err := v.TickAndBytes("z"); err != errAttemptToTickUnknownId {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+}
+
+func TestReceive(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 1, "b": 4}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	m, err := v.Receive("a", Clock{"a": 3, "b": 2, "c": 7})
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(m, Clock{"a": 4, "b": 4, "c": 7}) {
+		t.Fatalf("unexpected clock: %v\n", m)
+	}
+
+	h, err := v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if len(h) != 2 {
+		t.Fatalf("expected single history entry for receive, got %v\n", h)
+	}
+	if h[1].Change.Type != Receive || h[1].Change.Tick != "a" || !reflect.DeepEqual(h[1].Change.Merge, Clock{"a": 3, "b": 2, "c": 7}) {
+		t.Fatalf("unexpected history event: %v\n", h[1].Change)
+	}
+}
+
+func TestReceiveErrors(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 1}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	if _, err := v.Receive("a", nil); err != errClockMustNotBeNil {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+	if _, err := v.Receive("", Clock{"b": 1}); err != errClockIdMustNotBeEmptyString {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+	if _, err := v.Receive("z", Clock{"b": 1}); err != errAttemptToTickUnknownId {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+
+	// Failed receives must not alter the clock
+	m, err := v.GetClock()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(m, Clock{"a": 1}) {
+		t.Fatalf("unexpected clock: %v\n", m)
+	}
+
+	// Local identifier may be introduced by the remote clock
+	m, err = v.Receive("b", Clock{"b": 1})
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(m, Clock{"a": 1, "b": 2}) {
+		t.Fatalf("unexpected clock: %v\n", m)
+	}
+}
+
+func TestClockReceive(t *testing.T) {
+
+	c := Clock{"a": 1}
+
+	if err := c.Receive("z", Clock{"b": 3}); err != errAttemptToTickUnknownId {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+	if !reflect.DeepEqual(c, Clock{"a": 1}) {
+		t.Fatalf("clock altered by failed receive: %v\n", c)
+	}
+
+	if err := c.Receive("a", Clock{"b": 3}); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(c, Clock{"a": 2, "b": 3}) {
+		t.Fatalf("unexpected clock: %v\n", c)
+	}
+}
+
+func TestMergeClock(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := New(ctx, Clock{"a": 1, "b": 14}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	if err := v.MergeClock(nil); err != errClockMustNotBeNil {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+
+	if err := v.MergeClock(Clock{"a": 3, "b": 2, "c": 7}); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	m, err := v.GetClock()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(m, Clock{"a": 3, "b": 14, "c": 7}) {
+		t.Fatalf("unexpected clock: %v\n", m)
+	}
+}
+
+func TestMergeBytes(t *testing.T) {
+
+	ctx := context.Background()
+
+	for _, shortener := range []string{"", "SHA256"} {
+		for _, otherShortener := range []string{"", "SHA256"} {
+
+			v, err := New(ctx, Clock{"a": 1, "b": 14}, shortener)
+			if err != nil {
+				t.Fatalf("unexpected error %q\n", err.Error())
+			}
+			defer v.Close()
+
+			other, err := New(ctx, Clock{"a": 3, "b": 2, "c": 7}, otherShortener)
+			if err != nil {
+				t.Fatalf("unexpected error %q\n", err.Error())
+			}
+			defer other.Close()
+
+			b, err := other.Bytes()
+			if err != nil {
+				t.Fatalf("unexpected error %q\n", err.Error())
+			}
+
+			if err := v.MergeBytes(b); err != nil {
+				t.Fatalf("unexpected error %q\n", err.Error())
+			}
+
+			m, err := v.GetClock()
+			if err != nil {
+				t.Fatalf("unexpected error %q\n", err.Error())
+			}
+			if !reflect.DeepEqual(m, Clock{"a": 3, "b": 14, "c": 7}) {
+				t.Fatalf("unexpected clock (%q, %q): %v\n", shortener, otherShortener, m)
+			}
+		}
+	}
+}
+
+func TestMergeBytesInvalid(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := New(ctx, Clock{"a": 1}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	if err := v.MergeBytes([]byte("not a clock")); err == nil {
+		t.Fatal("expected error but didn't get one")
+	}
+}
+
+func TestUpdate(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 1}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	err = v.Update(func(tx *Tx) error {
+		if err := tx.Set("b", 0); err != nil {
+			return err
+		}
+		if err := tx.Tick("b"); err != nil {
+			return err
+		}
+		if v, ok := tx.Get("b"); !ok || v != 1 {
+			t.Errorf("unexpected value within transaction: %v %v\n", v, ok)
+		}
+		return tx.Merge(Clock{"a": 5, "c": 2})
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	h, err := v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if len(h) != 2 {
+		t.Fatalf("expected single history entry for transaction, got %v\n", h)
+	}
+	if h[1].Change.Type != Transaction || len(h[1].Change.Events) != 3 {
+		t.Fatalf("unexpected history event: %v\n", h[1].Change)
+	}
+	if !reflect.DeepEqual(h[1].Clock, Clock{"a": 5, "b": 1, "c": 2}) {
+		t.Fatalf("unexpected clock: %v\n", h[1].Clock)
+	}
+}
+
+func TestUpdateRollback(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 1}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	errTest := errors.New("test error")
+
+	tests := []struct {
+		fn   func(tx *Tx) error
+		want error
+	}{
+		{
+			fn: func(tx *Tx) error {
+				tx.Tick("a")
+				return errTest
+			},
+			want: errTest,
+		},
+		{
+			fn: func(tx *Tx) error {
+				tx.Tick("a")
+				tx.Tick("z") // Error is retained even though ignored here
+				return nil
+			},
+			want: errAttemptToTickUnknownId,
+		},
+		{
+			fn: func(tx *Tx) error {
+				tx.Set("b", 1)
+				tx.Set("a", 1)
+				return tx.Tick("b")
+			},
+			want: errAttemptToSetExistingId,
+		},
+		{
+			fn: func(tx *Tx) error {
+				tx.Tick("")
+				return nil
+			},
+			want: errClockIdMustNotBeEmptyString,
+		},
+		{
+			fn: func(tx *Tx) error {
+				return tx.Merge(nil)
+			},
+			want: errClockMustNotBeNil,
+		},
+		{
+			fn:   nil,
+			want: errTransactionFuncMustNotBeNil,
+		},
+	}
+
+	for i, test := range tests {
+		if err := v.Update(test.fn); err != test.want {
+			t.Fatalf("%d: unexpected error %v\n", i, err)
+		}
+	}
+
+	h, err := v.GetHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(h, []Clock{{"a": 1}}) {
+		t.Fatalf("unexpected history after rollback: %v\n", h)
+	}
+}
+
+func TestUpdateAfterClose(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := New(ctx, Clock{"a": 1}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	v.Close()
+
+	// Need this to guarantee test behaviour - need the context cancel()
+	// goroutine to execute so that the vector clock is actually closed
+	time.Sleep(1 * time.Millisecond)
+
+	if err := v.Update(func(tx *Tx) error { return tx.Tick("a") }); err != errClosedVClock {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+}
+
+func TestRetire(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 1, "b": 4, "c": 2}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	if err := v.Retire("b"); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.Retire("b"); err != errAttemptToRetireUnknownId {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+	if err := v.Retire(""); err != errClockIdMustNotBeEmptyString {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+
+	m, err := v.GetClock()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(m, Clock{"a": 1, "c": 2}) {
+		t.Fatalf("unexpected clock: %v\n", m)
+	}
+
+	r, err := v.GetRetired()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(r, Clock{"b": 4}) {
+		t.Fatalf("unexpected tombstones: %v\n", r)
+	}
+
+	h, err := v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if len(h) != 2 || h[1].Change.Type != Retire || h[1].Change.Retire != "b" {
+		t.Fatalf("unexpected history: %v\n", h)
+	}
+
+	// A clock still holding the retired identifier is not misread as being ahead
+	other, err := New(ctx, Clock{"a": 1, "b": 4, "c": 2}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer other.Close()
+
+	result, err := v.Compare(other)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if result != Equal {
+		t.Fatalf("expected Equal, got %v\n", result)
+	}
+
+	// Retired identifiers are not reintroduced by merges
+	if err := v.Merge(other); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if _, err := v.Receive("a", Clock{"b": 5}); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if _, ok := v.Get("b"); ok {
+		t.Fatal("retired identifier reintroduced by merge")
+	}
+
+	// Tombstones survive pruning
+	if err := v.Prune(); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.MergeClock(Clock{"b": 9}); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if _, ok := v.Get("b"); ok {
+		t.Fatal("retired identifier reintroduced after prune")
+	}
+
+	// Set reintroduces the identifier
+	if err := v.Set("b", 10); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if r, _ := v.GetRetired(); len(r) != 0 {
+		t.Fatalf("unexpected tombstones: %v\n", r)
+	}
+	if err := v.MergeClock(Clock{"b": 11}); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if val, _ := v.Get("b"); val != 11 {
+		t.Fatalf("unexpected value after reintroduction: %v\n", val)
+	}
+}
+
+func TestRetireWithoutHistory(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := New(ctx, Clock{"a": 1, "b": 4}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	if err := v.Retire("b"); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.Update(func(tx *Tx) error { return tx.Merge(Clock{"b": 5, "c": 1}) }); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	b, err := v.Bytes()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	v2, err := FromBytes(ctx, b, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v2.Close()
+
+	m, err := v2.GetClock()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(m, Clock{"a": 1, "c": 1}) {
+		t.Fatalf("unexpected clock: %v\n", m)
+	}
+}
+
+func TestSetMax(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 5}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	if err := v.SetMax("a", 3); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.SetMax("b", 3); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.SetMax("b", 7); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.SetMax("", 7); err != errClockIdMustNotBeEmptyString {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+
+	h, err := v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if len(h) != 4 || h[3].Change.Type != SetMax || *h[3].Change.Set != (SetInfo{Id: "b", Value: 7}) {
+		t.Fatalf("unexpected history: %v\n", h)
+	}
+	if !reflect.DeepEqual(h[3].Clock, Clock{"a": 5, "b": 7}) {
+		t.Fatalf("unexpected clock: %v\n", h[3].Clock)
+	}
+}
+
+func TestAdvance(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 5}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	if err := v.Advance("a", 10); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.Advance("b", 10); err != errAttemptToAdvanceUnknownId {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+	if err := v.Advance("", 10); err != errClockIdMustNotBeEmptyString {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+
+	h, err := v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if len(h) != 2 || h[1].Change.Type != Advance {
+		t.Fatalf("unexpected history: %v\n", h)
+	}
+	if !reflect.DeepEqual(h[1].Clock, Clock{"a": 15}) {
+		t.Fatalf("unexpected clock: %v\n", h[1].Clock)
+	}
+}
+
+func TestClockSetMaxAdvance(t *testing.T) {
+
+	c := Clock{"a": 5}
+
+	c.SetMax("a", 2)
+	c.SetMax("b", 2)
+	c.Advance("b", 3)
+
+	if err := c.Advance("z", 1); err != errAttemptToAdvanceUnknownId {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+	if !reflect.DeepEqual(c, Clock{"a": 5, "b": 5}) {
+		t.Fatalf("unexpected clock: %v\n", c)
+	}
+}
+
+func TestAdvanceOverflow(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 5, "b": 1}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	if err := v.Advance("a", math.MaxUint64); err != errAttemptToOverflowId {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errAttemptToOverflowId.Error(), err)
+	}
+	if err := v.Advance("a", math.MaxUint64-5); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.Advance("a", 1); err != errAttemptToOverflowId {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errAttemptToOverflowId.Error(), err)
+	}
+
+	// The transaction fails as a whole, so the tick of b is not applied
+	err = v.Update(func(tx *Tx) error {
+		if err := tx.Tick("b"); err != nil {
+			return err
+		}
+		return tx.Advance("a", 1)
+	})
+	if err != errAttemptToOverflowId {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errAttemptToOverflowId.Error(), err)
+	}
+
+	c, _ := v.GetClock()
+	if !reflect.DeepEqual(c, Clock{"a": math.MaxUint64, "b": 1}) {
+		t.Fatalf("unexpected clock: %v\n", c)
+	}
+	if h, _ := v.GetFullHistory(); len(h) != 2 {
+		t.Fatalf("unexpected history length: %d\n", len(h))
+	}
+
+	cl := Clock{"a": 5}
+	if err := cl.Advance("a", math.MaxUint64); err != errAttemptToOverflowId {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errAttemptToOverflowId.Error(), err)
+	}
+	if !reflect.DeepEqual(cl, Clock{"a": 5}) {
+		t.Fatalf("unexpected clock: %v\n", cl)
+	}
+}
+
+func TestClockDiff(t *testing.T) {
+
+	c1 := Clock{"a": 1, "b": 14, "c": 3, "d": 2}
+	c2 := Clock{"a": 1, "b": 10, "c": 5, "e": 7}
+
+	expected := []IdentifierDiff{
+		{Id: "a", Local: 1, Remote: 1, Relation: Same},
+		{Id: "b", Local: 14, Remote: 10, Relation: Ahead},
+		{Id: "c", Local: 3, Remote: 5, Relation: Behind},
+		{Id: "d", Local: 2, Remote: 0, Relation: LocalOnly},
+		{Id: "e", Local: 0, Remote: 7, Relation: RemoteOnly},
+	}
+
+	if d := c1.Diff(c2); !reflect.DeepEqual(d, expected) {
+		t.Fatalf("unexpected diff: %v\n", d)
+	}
+}
+
+func TestDiff(t *testing.T) {
+
+	ctx := context.Background()
+
+	v1, err := New(ctx, Clock{"a": 1, "b": 14, "c": 3, "d": 2}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v1.Close()
+
+	v2, err := New(ctx, Clock{"a": 1, "b": 10, "c": 5, "e": 7}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v2.Close()
+
+	if err := v1.Retire("a"); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	d, err := v1.Diff(v2)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	expected := []IdentifierDiff{
+		{Id: "b", Local: 14, Remote: 10, Relation: Ahead},
+		{Id: "c", Local: 3, Remote: 5, Relation: Behind},
+		{Id: "d", Local: 2, Remote: 0, Relation: LocalOnly},
+		{Id: "e", Local: 0, Remote: 7, Relation: RemoteOnly},
+	}
+	if !reflect.DeepEqual(d, expected) {
+		t.Fatalf("unexpected diff: %v\n", d)
+	}
+
+	if _, err := v1.Diff(nil); err != errClockMustNotBeNil {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+}
+
+func TestClockCompareWithMode(t *testing.T) {
+
+	tests := []struct {
+		c1, c2 Clock
+		strict Ordering
+		zero   Ordering
+	}{
+		{Clock{"a": 1}, Clock{"a": 1, "b": 0}, Descendant, Equal},
+		{Clock{"a": 1, "b": 0}, Clock{"a": 1}, Ancestor, Equal},
+		{Clock{"a": 1, "c": 0}, Clock{"a": 2, "b": 0}, Concurrent, Descendant},
+		{Clock{"a": 2, "c": 0}, Clock{"a": 1, "b": 0}, Concurrent, Ancestor},
+		{Clock{"a": 1}, Clock{"b": 1}, Concurrent, Concurrent},
+		{Clock{"a": 1}, Clock{"a": 1, "b": 1}, Descendant, Descendant},
+	}
+
+	for i, test := range tests {
+		if got := test.c1.CompareWithMode(test.c2, StrictCompare); got != test.strict {
+			t.Fatalf("%d: expected %v, got %v\n", i, test.strict, got)
+		}
+		if got := test.c1.CompareWithMode(test.c2, ZeroDefaultCompare); got != test.zero {
+			t.Fatalf("%d: expected %v, got %v\n", i, test.zero, got)
+		}
+	}
+}
+
+func TestWithCompareMode(t *testing.T) {
+
+	ctx := context.Background()
+
+	v1, err := New(ctx, Clock{"a": 1, "c": 0}, "", WithCompareMode(ZeroDefaultCompare))
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v1.Close()
+
+	v2, err := New(ctx, Clock{"a": 2, "b": 0}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v2.Close()
+
+	checkBool := func(name string, f func(*VClock) (bool, error), want bool) {
+		result, err := f(v2)
+		if err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+		if result != want {
+			t.Fatalf("%s: expected %v, got %v\n", name, want, result)
+		}
+	}
+
+	checkBool("DescendsFrom", v1.DescendsFrom, true)
+	checkBool("AncestorOf", v1.AncestorOf, false)
+	checkBool("Equal", v1.Equal, false)
+	checkBool("Concurrent", v1.Concurrent, false)
+
+	result, err := v1.Compare(v2)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if result != Descendant {
+		t.Fatalf("expected Descendant, got %v\n", result)
+	}
+
+	result, err = v1.CompareWithMode(v2, StrictCompare)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if result != Concurrent {
+		t.Fatalf("expected Concurrent, got %v\n", result)
+	}
+
+	// The default mode remains strict
+	result, err = v2.Compare(v1)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if result != Concurrent {
+		t.Fatalf("expected Concurrent, got %v\n", result)
+	}
+
+	// Copy preserves the mode
+	v3, err := v1.Copy()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v3.Close()
+
+	v3.Set("d", 0)
+	equal, err := v3.Equal(v1)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !equal {
+		t.Fatal("expected equality (true) but false returned")
+	}
+}
+
+func TestRelationMatrix(t *testing.T) {
+
+	clocks := []Clock{
+		{"a": 1},
+		{"a": 2},
+		{"a": 1, "b": 1},
+	}
+
+	expected := [][]Ordering{
+		{Equal, Descendant, Descendant},
+		{Ancestor, Equal, Concurrent},
+		{Ancestor, Concurrent, Equal},
+	}
+
+	if m := RelationMatrix(clocks); !reflect.DeepEqual(m, expected) {
+		t.Fatalf("unexpected matrix: %v\n", m)
+	}
+}
+
+func TestCausalSort(t *testing.T) {
+
+	clocks := []Clock{
+		{"a": 3, "b": 1},
+		{"a": 2, "b": 1},
+		{"a": 1},
+		{"a": 1, "c": 1},
+		{"a": 2},
+	}
+
+	expected := []Clock{
+		{"a": 1},
+		{"a": 1, "c": 1},
+		{"a": 2},
+		{"a": 2, "b": 1},
+		{"a": 3, "b": 1},
+	}
+
+	if sorted := CausalSort(clocks); !reflect.DeepEqual(sorted, expected) {
+		t.Fatalf("unexpected sort: %v\n", sorted)
+	}
+
+	if sorted := CausalSort(nil); len(sorted) != 0 {
+		t.Fatalf("unexpected sort: %v\n", sorted)
+	}
+}
+
+func TestMaxima(t *testing.T) {
+
+	clocks := []Clock{
+		{"a": 1},
+		{"a": 2, "b": 1},
+		{"a": 1, "c": 1},
+		{"a": 2},
+		{"a": 2, "b": 1},
+	}
+
+	expected := []Clock{
+		{"a": 2, "b": 1},
+		{"a": 1, "c": 1},
+	}
+
+	if m := Maxima(clocks); !reflect.DeepEqual(m, expected) {
+		t.Fatalf("unexpected maxima: %v\n", m)
+	}
+}
+
+func TestConcurrentClasses(t *testing.T) {
+
+	clocks := []Clock{
+		{"a": 2, "b": 1},
+		{"a": 1},
+		{"a": 1, "c": 1},
+		{"a": 2},
+		{"b": 1},
+	}
+
+	expected := [][]Clock{
+		{{"a": 1}, {"b": 1}},
+		{{"a": 1, "c": 1}, {"a": 2}},
+		{{"a": 2, "b": 1}},
+	}
+
+	if c := ConcurrentClasses(clocks); !reflect.DeepEqual(c, expected) {
+		t.Fatalf("unexpected classes: %v\n", c)
+	}
+}
+
+func TestJoinMeet(t *testing.T) {
+
+	c1 := Clock{"a": 1, "b": 5, "c": 2}
+	c2 := Clock{"a": 3, "b": 2}
+	c3 := Clock{"a": 2, "b": 4, "d": 1}
+
+	if j := Join(c1, c2, c3); !reflect.DeepEqual(j, Clock{"a": 3, "b": 5, "c": 2, "d": 1}) {
+		t.Fatalf("unexpected join: %v\n", j)
+	}
+	if m := Meet(c1, c2, c3); !reflect.DeepEqual(m, Clock{"a": 1, "b": 2}) {
+		t.Fatalf("unexpected meet: %v\n", m)
+	}
+	if !reflect.DeepEqual(c1, Clock{"a": 1, "b": 5, "c": 2}) {
+		t.Fatalf("clock altered: %v\n", c1)
+	}
+
+	if j := Join(); len(j) != 0 {
+		t.Fatalf("unexpected join: %v\n", j)
+	}
+	if m := Meet(); len(m) != 0 {
+		t.Fatalf("unexpected meet: %v\n", m)
+	}
+}
+
+func TestMergeAll(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 1}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	others := []*VClock{}
+	for _, c := range []Clock{{"a": 3, "b": 1}, {"b": 4}, {"c": 2}} {
+		other, err := New(ctx, c, "")
+		if err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+		defer other.Close()
+		others = append(others, other)
+	}
+
+	if err := v.MergeAll(others...); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	h, err := v.GetHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(h, []Clock{{"a": 1}, {"a": 3, "b": 4, "c": 2}}) {
+		t.Fatalf("unexpected history: %v\n", h)
+	}
+
+	// Merging no clocks does not record an update
+	if err := v.MergeAll(); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if n, _ := v.GetHistoryLen(); n != 2 {
+		t.Fatalf("unexpected history length: %v\n", n)
+	}
+
+	if err := v.MergeAll(others[0], nil); err != errClockMustNotBeNil {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+
+	others[1].Close()
+
+	// Need this to guarantee test behaviour - need the context cancel()
+	// goroutine to execute so that the vector clock is actually closed
+	time.Sleep(1 * time.Millisecond)
+
+	if err := v.MergeAll(others...); err != errClosedVClock {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+}
+
+func TestClockProject(t *testing.T) {
+
+	c := Clock{"a": 1, "b": 2, "c": 3}
+
+	if p := c.Project([]string{"a", "c", "z"}); !reflect.DeepEqual(p, Clock{"a": 1, "c": 3}) {
+		t.Fatalf("unexpected projection: %v\n", p)
+	}
+	if p := c.Project(nil); len(p) != 0 {
+		t.Fatalf("unexpected projection: %v\n", p)
+	}
+
+	other := Clock{"a": 2, "b": 1, "d": 7}
+	if o := c.CompareOn(other, []string{"a"}); o != Descendant {
+		t.Fatalf("expected Descendant, got %v\n", o)
+	}
+	if o := c.CompareOn(other, []string{"a", "b"}); o != Concurrent {
+		t.Fatalf("expected Concurrent, got %v\n", o)
+	}
+	if o := c.CompareOn(other, []string{"c"}); o != Ancestor {
+		t.Fatalf("expected Ancestor, got %v\n", o)
+	}
+}
+
+func TestCompareOn(t *testing.T) {
+
+	ctx := context.Background()
+
+	v1, err := New(ctx, Clock{"a": 1, "b": 2, "c": 3}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v1.Close()
+
+	v2, err := New(ctx, Clock{"a": 2, "b": 1, "d": 7}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v2.Close()
+
+	tests := []struct {
+		ids  []string
+		want Ordering
+	}{
+		{[]string{"a"}, Descendant},
+		{[]string{"a", "b"}, Concurrent},
+		{[]string{"c"}, Ancestor},
+		{[]string{"z"}, Equal},
+		{nil, Equal},
+	}
+
+	for i, test := range tests {
+		result, err := v1.CompareOn(v2, test.ids)
+		if err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+		if result != test.want {
+			t.Fatalf("%d: expected %v, got %v\n", i, test.want, result)
+		}
+	}
+
+	if _, err := v1.CompareOn(nil, []string{"a"}); err != errClockMustNotBeNil {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+}
+
+func TestClockLag(t *testing.T) {
+
+	c1 := Clock{"a": 1, "b": 14, "c": 3}
+	c2 := Clock{"a": 4, "b": 10, "c": 3, "d": 2}
+
+	expected := Distance{
+		Behind:      Clock{"a": 3, "d": 2},
+		Ahead:       Clock{"b": 4},
+		TotalBehind: 5,
+		TotalAhead:  4,
+	}
+
+	if d := c1.Lag(c2); !reflect.DeepEqual(d, expected) {
+		t.Fatalf("unexpected distance: %v\n", d)
+	}
+}
+
+func TestLag(t *testing.T) {
+
+	ctx := context.Background()
+
+	v1, err := New(ctx, Clock{"a": 1, "b": 14, "c": 3, "e": 1}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v1.Close()
+
+	v2, err := New(ctx, Clock{"a": 4, "b": 10, "c": 3, "d": 2, "e": 8}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v2.Close()
+
+	if err := v1.Retire("e"); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	d, err := v1.Lag(v2)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	expected := Distance{
+		Behind:      Clock{"a": 3, "d": 2},
+		Ahead:       Clock{"b": 4},
+		TotalBehind: 5,
+		TotalAhead:  4,
+	}
+	if !reflect.DeepEqual(d, expected) {
+		t.Fatalf("unexpected distance: %v\n", d)
+	}
+
+	if _, err := v1.Lag(nil); err != errClockMustNotBeNil {
+		t.Fatalf("unexpected error %v\n", err)
+	}
+}
+
+func TestMaxHistoryItems(t *testing.T) {
+
+	ctx := context.Background()
+
+	type pruned struct{ from, to uint64 }
+	reported := []pruned{}
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0}, "",
+		WithMaxHistoryItems(3),
+		WithHistoryPruned(func(from, to uint64) { reported = append(reported, pruned{from, to}) }))
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	for i := 0; i < 5; i++ {
+		if err := v.Tick("a"); err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+	}
+
+	h, err := v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if len(h) != 3 || h[0].HistoryId != 3 || h[2].HistoryId != 5 {
+		t.Fatalf("unexpected history: %v\n", h)
+	}
+	if !reflect.DeepEqual(h[0].Clock, Clock{"a": 3}) {
+		t.Fatalf("unexpected clock: %v\n", h[0].Clock)
+	}
+
+	first, err := v.EarliestHistoryId()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if first != 3 {
+		t.Fatalf("unexpected earliest id: %v\n", first)
+	}
+
+	if err := v.Prune(); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if first, _ := v.EarliestHistoryId(); first != 5 {
+		t.Fatalf("unexpected earliest id after prune: %v\n", first)
+	}
+
+	expected := []pruned{{0, 0}, {1, 1}, {2, 2}, {3, 4}}
+	if !reflect.DeepEqual(reported, expected) {
+		t.Fatalf("unexpected pruned ranges: %v\n", reported)
+	}
+}
+
+func TestMaxHistoryBytes(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0, "b": 0}, "", WithMaxHistoryBytes(1024))
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	for i := 0; i < 100; i++ {
+		if err := v.Tick("a"); err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+	}
+
+	h, err := v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if len(h) >= 100 || len(h) == 0 {
+		t.Fatalf("unexpected history length: %v\n", len(h))
+	}
+	if h[len(h)-1].HistoryId != 100 || !reflect.DeepEqual(h[len(h)-1].Clock, Clock{"a": 100, "b": 0}) {
+		t.Fatalf("latest history item not retained: %v\n", h[len(h)-1])
+	}
+
+	// The limit applies to the history as stored, where only checkpoints hold a Clock
+	shortener, _ := GetShortenerFactory().Get("NoOp")
+	hist := newHistory(Clock{"a": 0, "b": 0}, shortener, false, time.Now)
+	hist.retention = retention{maxBytes: 1024}
+
+	for i := 0; i < 100; i++ {
+		if err := hist.apply(&Event{Type: Tick, Tick: "a"}); err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+	}
+
+	size := 0
+	for _, item := range hist.items {
+		size += item.approxSize()
+	}
+	if size != hist.size {
+		t.Fatalf("unexpected history size: expected %v, got %v\n", size, hist.size)
+	}
+	if size > 1024 {
+		t.Fatalf("history exceeds size limit: %v\n", size)
+	}
+}
+
+func TestMaxHistoryAge(t *testing.T) {
+
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	shortener, _ := GetShortenerFactory().Get("NoOp")
+	h := newHistory(Clock{"a": 0}, shortener, false, func() time.Time { return now })
+	h.retention = retention{maxAge: 10 * time.Second}
+
+	for i := 0; i < 5; i++ {
+		now = now.Add(4 * time.Second)
+		if err := h.apply(&Event{Type: Tick, Tick: "a"}); err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+	}
+
+	// Only the items applied at 12, 16 and 20 seconds are within 10 seconds of the latest
+	if h.getFirstId() != 3 || h.getLastId() != 5 {
+		t.Fatalf("unexpected history range: %v - %v\n", h.getFirstId(), h.getLastId())
+	}
+
+	// The latest item is always retained
+	now = now.Add(time.Hour)
+	if err := h.apply(&Event{Type: Tick, Tick: "a"}); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if h.getFirstId() != 6 || !reflect.DeepEqual(h.latest(), Clock{"a": 6}) {
+		t.Fatalf("unexpected history: %v\n", h.items)
+	}
+}
+
+func TestGetHistoryRange(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0}, "SHA256", WithMaxHistoryItems(8))
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := v.Tick("a"); err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+	}
+
+	n, err := v.GetHistoryLen()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if n != 8 {
+		t.Fatalf("unexpected history length: %v\n", n)
+	}
+
+	last, err := v.LatestHistoryId()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if last != 10 {
+		t.Fatalf("unexpected latest id: %v\n", last)
+	}
+
+	tests := []struct {
+		from, to uint64
+		expected []Clock
+	}{
+		{4, 6, []Clock{{"a": 4}, {"a": 5}, {"a": 6}}},
+		{6, 4, []Clock{{"a": 4}, {"a": 5}, {"a": 6}}},
+		{0, 3, []Clock{{"a": 3}}},
+		{0, 1, []Clock{}},
+		{9, math.MaxUint64, []Clock{{"a": 9}, {"a": 10}}},
+		{11, 20, []Clock{}},
+	}
+
+	for i, test := range tests {
+		h, err := v.GetHistoryRange(test.from, test.to)
+		if err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+		if !reflect.DeepEqual(h, test.expected) {
+			t.Fatalf("%d: unexpected history: %v\n", i, h)
+		}
+
+		full, err := v.GetFullHistoryRange(test.from, test.to)
+		if err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+		if len(full) != len(test.expected) {
+			t.Fatalf("%d: unexpected full history: %v\n", i, full)
+		}
+		for j, item := range full {
+			if !reflect.DeepEqual(item.Clock, test.expected[j]) || item.Change.Type != Tick {
+				t.Fatalf("%d: unexpected full history item: %v\n", i, item)
+			}
+		}
+	}
+}
+
+func TestQueryHistory(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0, "b": 0}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	v.Tick("a")                   // 1
+	v.Tick("b")                   // 2
+	v.MergeClock(Clock{"c": 3})   // 3
+	v.Set("d", 1)                 // 4
+	v.Receive("a", Clock{"b": 5}) // 5
+	v.MergeClock(Clock{"a": 9})   // 6
+	v.Update(func(tx *Tx) error { // 7
+		return tx.Tick("d")
+	})
+
+	ids := func(items []*HistoryItem) []uint64 {
+		ret := []uint64{}
+		for _, item := range items {
+			ret = append(ret, item.HistoryId)
+		}
+		return ret
+	}
+
+	tests := []struct {
+		q        HistoryQuery
+		expected []uint64
+	}{
+		{HistoryQuery{}, []uint64{0, 1, 2, 3, 4, 5, 6, 7}},
+		{HistoryQuery{Types: Merge}, []uint64{3, 6}},
+		{HistoryQuery{Types: Merge | Receive}, []uint64{3, 5, 6}},
+		{HistoryQuery{Ids: []string{"a"}}, []uint64{1, 5, 6}},
+		{HistoryQuery{Ids: []string{"b", "d"}}, []uint64{2, 4, 5, 7}},
+		{HistoryQuery{Types: Merge, Ids: []string{"a"}}, []uint64{6}},
+		{HistoryQuery{Ids: []string{"a"}, FromId: 2, ToId: 5}, []uint64{5}},
+		{HistoryQuery{FromId: 6}, []uint64{6, 7}},
+		{HistoryQuery{FromId: 8}, []uint64{}},
+	}
+
+	for i, test := range tests {
+		h, err := v.QueryHistory(test.q)
+		if err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+		if got := ids(h); !reflect.DeepEqual(got, test.expected) {
+			t.Fatalf("%d: expected %v, got %v\n", i, test.expected, got)
+		}
+	}
+
+	h, err := v.QueryHistory(HistoryQuery{Types: Set})
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if len(h) != 1 || !reflect.DeepEqual(h[0].Clock, Clock{"a": 1, "b": 1, "c": 3, "d": 1}) {
+		t.Fatalf("unexpected history: %v\n", h)
+	}
+}
+
+func TestGetClockAt(t *testing.T) {
+
+	ctx := context.Background()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0}, "SHA256", WithTimeSource(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	for i := 0; i < 5; i++ {
+		now = now.Add(10 * time.Second)
+		v.Tick("a")
+	}
+
+	tests := []struct {
+		t        time.Time
+		expected Clock
+	}{
+		{start, Clock{"a": 0}},
+		{start.Add(9 * time.Second), Clock{"a": 0}},
+		{start.Add(10 * time.Second), Clock{"a": 1}},
+		{start.Add(35 * time.Second), Clock{"a": 3}},
+		{start.Add(time.Hour), Clock{"a": 5}},
+	}
+
+	for i, test := range tests {
+		c, err := v.GetClockAt(test.t)
+		if err != nil {
+			t.Fatalf("(%d) unexpected error %q\n", i, err.Error())
+		}
+		if !reflect.DeepEqual(c, test.expected) {
+			t.Fatalf("(%d) unexpected clock: expected %v, got %v\n", i, test.expected, c)
+		}
+	}
+
+	_, err = v.GetClockAt(start.Add(-time.Second))
+	if err == nil {
+		t.Fatal("expected error for time before history, got nil")
+	}
+	if err != errHistoryNotAvailable {
+		t.Fatalf("unexpected error: expected %q, got %q\n", errHistoryNotAvailable.Error(), err.Error())
+	}
+}
+
+func TestQueryHistoryByTime(t *testing.T) {
+
+	ctx := context.Background()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0}, "SHA256", WithTimeSource(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	for i := 0; i < 5; i++ {
+		now = now.Add(10 * time.Second)
+		v.Tick("a")
+	}
+
+	ids := func(items []*HistoryItem) []uint64 {
+		ret := []uint64{}
+		for _, item := range items {
+			ret = append(ret, item.HistoryId)
+		}
+		return ret
+	}
+
+	tests := []struct {
+		q        HistoryQuery
+		expected []uint64
+	}{
+		{HistoryQuery{FromTime: start.Add(20 * time.Second)}, []uint64{2, 3, 4, 5}},
+		{HistoryQuery{ToTime: start.Add(15 * time.Second)}, []uint64{0, 1}},
+		{HistoryQuery{FromTime: start.Add(15 * time.Second), ToTime: start.Add(30 * time.Second)}, []uint64{2, 3}},
+		{HistoryQuery{FromTime: start.Add(time.Hour)}, []uint64{}},
+		{HistoryQuery{FromTime: start.Add(10 * time.Second), FromId: 3}, []uint64{3, 4, 5}},
+	}
+
+	for i, test := range tests {
+		items, err := v.QueryHistory(test.q)
+		if err != nil {
+			t.Fatalf("(%d) unexpected error %q\n", i, err.Error())
+		}
+		if !reflect.DeepEqual(ids(items), test.expected) {
+			t.Fatalf("(%d) unexpected items: expected %v, got %v\n", i, test.expected, ids(items))
+		}
+		for _, item := range items {
+			if !item.Time.Equal(start.Add(time.Duration(item.HistoryId) * 10 * time.Second)) {
+				t.Fatalf("(%d) unexpected time for item %d: %v\n", i, item.HistoryId, item.Time)
+			}
+		}
+	}
+}
+
+func TestGetClockAtClosed(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	v.Close()
+
+	// Allow time for the Close() to complete
+	time.Sleep(1 * time.Millisecond)
+
+	_, err = v.GetClockAt(time.Now())
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if err != errClosedVClock {
+		t.Fatalf("unexpected error: expected %q, got %q\n", errClosedVClock.Error(), err.Error())
+	}
+}
+
+func TestEventMetadata(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	md := map[string]string{"request": "r1"}
+
+	if err := v.TickWithMetadata("a", md); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.SetWithMetadata("b", 3, map[string]string{"request": "r2"}); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.MergeClockWithMetadata(Clock{"c": 4}, map[string]string{"peer": "p1"}); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	other, err := New(ctx, Clock{"d": 5}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer other.Close()
+
+	if err := v.MergeWithMetadata(other, map[string]string{"peer": "p2"}); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.Tick("a"); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	// Changes to the caller's map must not affect the recorded metadata
+	md["request"] = "changed"
+
+	history, err := v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	expected := []map[string]string{
+		nil,
+		{"request": "r1"},
+		{"request": "r2"},
+		{"peer": "p1"},
+		{"peer": "p2"},
+		nil,
+	}
+
+	if len(history) != len(expected) {
+		t.Fatalf("unexpected history length: expected %d, got %d\n", len(expected), len(history))
+	}
+
+	for i, item := range history {
+		var got map[string]string
+		if item.Change != nil {
+			got = item.Change.Metadata
+		}
+		if !reflect.DeepEqual(got, expected[i]) {
+			t.Fatalf("(%d) unexpected metadata: expected %v, got %v\n", i, expected[i], got)
+		}
+	}
+
+	// Changes to the returned history must not affect the clock's history
+	history[1].Change.Metadata["request"] = "changed"
+
+	history, err = v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if history[1].Change.Metadata["request"] != "r1" {
+		t.Fatalf("unexpected metadata: %v\n", history[1].Change.Metadata)
+	}
+
+	// Metadata survives serialisation of the history
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(history); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	var decoded []*HistoryItem
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	for i, item := range decoded {
+		if item.Change == nil {
+			continue
+		}
+		if !reflect.DeepEqual(item.Change.Metadata, history[i].Change.Metadata) {
+			t.Fatalf("(%d) unexpected decoded metadata: expected %v, got %v\n", i, history[i].Change.Metadata, item.Change.Metadata)
+		}
+	}
+}
+
+func TestEventMetadataErrors(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	md := map[string]string{"request": "r1"}
+
+	if err := v.TickWithMetadata("x", md); err != errAttemptToTickUnknownId {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errAttemptToTickUnknownId.Error(), err)
+	}
+	if err := v.SetWithMetadata("a", 1, md); err != errAttemptToSetExistingId {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errAttemptToSetExistingId.Error(), err)
+	}
+	if err := v.MergeWithMetadata(nil, md); err != errClockMustNotBeNil {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errClockMustNotBeNil.Error(), err)
+	}
+	if err := v.MergeClockWithMetadata(nil, md); err != errClockMustNotBeNil {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errClockMustNotBeNil.Error(), err)
+	}
+
+	history, err := v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if len(history) != 1 {
+		t.Fatalf("unexpected history: %v\n", history)
+	}
+}
+
+func TestNewFromHistory(t *testing.T) {
+
+	ctx := context.Background()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	ts := WithTimeSource(func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	})
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0, "b": 0}, "SHA256", ts, WithMaxHistoryItems(6))
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	v.Tick("a")
+	v.TickWithMetadata("b", map[string]string{"request": "r1"})
+	v.MergeClock(Clock{"c": 3})
+	v.Set("d", 1)
+	v.Receive("a", Clock{"b": 5})
+	v.Retire("c")
+	v.MergeClock(Clock{"c": 9, "e": 2})
+	v.Update(func(tx *Tx) error {
+		if err := tx.Tick("d"); err != nil {
+			return err
+		}
+		return tx.Advance("a", 3)
+	})
+	v.SetMax("b", 10)
+
+	history, err := v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if history[0].HistoryId == 0 {
+		t.Fatalf("expected history to have been pruned: %v\n", history)
+	}
+
+	v2, err := NewFromHistory(ctx, history, "", ts)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v2.Close()
+
+	history2, err := v2.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(history, history2) {
+		t.Fatalf("unexpected history: expected %v, got %v\n", history, history2)
+	}
+
+	// The rebuilt clock continues from the last HistoryId
+	if err := v2.Tick("a"); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	last, err := v2.LatestHistoryId()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if last != history[len(history)-1].HistoryId+1 {
+		t.Fatalf("unexpected latest history id: %d\n", last)
+	}
+}
+
+func TestNewFromHistoryDivergence(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	v.Tick("a")
+	v.Set("b", 2)
+	v.Tick("b")
+
+	history, err := v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	tampered := func(f func(h []*HistoryItem) []*HistoryItem) []*HistoryItem {
+		h, _ := v.GetFullHistory()
+		return f(h)
+	}
+
+	tests := []struct {
+		items    []*HistoryItem
+		id       uint64
+		expected error
+	}{
+		{
+			tampered(func(h []*HistoryItem) []*HistoryItem { h[2].Clock["b"] = 3; return h }),
+			2,
+			nil,
+		},
+		{
+			tampered(func(h []*HistoryItem) []*HistoryItem { return append(h[:1], h[2:]...) }),
+			2,
+			errHistoryIdNotContiguous,
+		},
+		{
+			tampered(func(h []*HistoryItem) []*HistoryItem { h[3].Change = nil; return h }),
+			3,
+			errHistoryChangeMustNotBeNil,
+		},
+		{
+			tampered(func(h []*HistoryItem) []*HistoryItem { h[1].Change.Tick = "x"; return h }),
+			1,
+			errAttemptToTickUnknownId,
+		},
+	}
+
+	for i, test := range tests {
+		_, err := NewFromHistory(ctx, test.items, "")
+		if err == nil {
+			t.Fatalf("(%d) expected error but got nil\n", i)
+		}
+
+		var d *HistoryDivergenceError
+		if !errors.As(err, &d) {
+			t.Fatalf("(%d) unexpected error type: %v\n", i, err)
+		}
+		if d.HistoryId != test.id {
+			t.Fatalf("(%d) unexpected divergence: expected %d, got %d\n", i, test.id, d.HistoryId)
+		}
+		if d.Err != test.expected {
+			t.Fatalf("(%d) unexpected error: expected %v, got %v\n", i, test.expected, d.Err)
+		}
+		if test.expected != nil && !errors.Is(err, test.expected) {
+			t.Fatalf("(%d) expected error to wrap %v\n", i, test.expected)
+		}
+		if test.expected == nil && !reflect.DeepEqual(d.Actual, history[test.id].Clock) {
+			t.Fatalf("(%d) unexpected actual clock: expected %v, got %v\n", i, history[test.id].Clock, d.Actual)
+		}
+	}
+
+	if _, err := NewFromHistory(ctx, nil, ""); err != errHistoryMustNotBeEmpty {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errHistoryMustNotBeEmpty.Error(), err)
+	}
+	if _, err := NewFromHistory(ctx, []*HistoryItem{history[0], nil}, ""); err != errHistoryItemMustNotBeNil {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errHistoryItemMustNotBeNil.Error(), err)
+	}
+}
+
+func TestHistoryCheckpoints(t *testing.T) {
+
+	ctx := context.Background()
+
+	const n = 5*checkpointInterval + 7
+
+	test := func(opts ...Option) {
+		v, err := NewWithHistory(ctx, Clock{"a": 0}, "SHA256", opts...)
+		if err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+		defer v.Close()
+
+		expected := map[uint64]Clock{0: {"a": 0}}
+		for i := 1; i <= n; i++ {
+			var err error
+			switch {
+			case i%17 == 0:
+				err = v.Set(fmt.Sprint("s", i), uint64(i))
+			case i%23 == 0:
+				err = v.MergeClock(Clock{"n": uint64(i)})
+			case i%29 == 0:
+				err = v.SetMax("m", uint64(i))
+			case i%31 == 0:
+				err = v.Retire("m")
+			default:
+				err = v.Tick("a")
+			}
+			if err != nil {
+				t.Fatalf("(%d) unexpected error %q\n", i, err.Error())
+			}
+			c, err := v.GetClock()
+			if err != nil {
+				t.Fatalf("unexpected error %q\n", err.Error())
+			}
+			expected[uint64(i)] = c
+		}
+
+		first, err := v.EarliestHistoryId()
+		if err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+
+		history, err := v.GetFullHistory()
+		if err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+		if len(history) != int(n-first+1) {
+			t.Fatalf("unexpected history length: %d\n", len(history))
+		}
+		for _, item := range history {
+			if !reflect.DeepEqual(item.Clock, expected[item.HistoryId]) {
+				t.Fatalf("(%d) unexpected clock: expected %v, got %v\n", item.HistoryId, expected[item.HistoryId], item.Clock)
+			}
+		}
+
+		for _, r := range [][2]uint64{{first, first}, {first + 3, first + 70}, {130, 200}, {n - 1, n}} {
+			clocks, err := v.GetHistoryRange(r[0], r[1])
+			if err != nil {
+				t.Fatalf("unexpected error %q\n", err.Error())
+			}
+			for i, c := range clocks {
+				if !reflect.DeepEqual(c, expected[r[0]+uint64(i)]) {
+					t.Fatalf("(%d) unexpected clock: expected %v, got %v\n", r[0]+uint64(i), expected[r[0]+uint64(i)], c)
+				}
+			}
+		}
+
+		items, err := v.QueryHistory(HistoryQuery{Types: Set})
+		if err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+		for _, item := range items {
+			if !reflect.DeepEqual(item.Clock, expected[item.HistoryId]) {
+				t.Fatalf("(%d) unexpected clock: expected %v, got %v\n", item.HistoryId, expected[item.HistoryId], item.Clock)
+			}
+		}
+	}
+
+	test()
+	test(WithMaxHistoryItems(100))
+	test(WithMaxHistoryItems(checkpointInterval))
+}
+
+func TestGetClockAtHistoryId(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0}, "SHA256", WithMaxHistoryItems(100))
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	for i := 0; i < 150; i++ {
+		v.Tick("a")
+	}
+
+	for _, id := range []uint64{51, 64, 100, 149, 150} {
+		c, err := v.GetClockAtHistoryId(id)
+		if err != nil {
+			t.Fatalf("(%d) unexpected error %q\n", id, err.Error())
+		}
+		if !reflect.DeepEqual(c, Clock{"a": id}) {
+			t.Fatalf("(%d) unexpected clock: %v\n", id, c)
+		}
+	}
+
+	for _, id := range []uint64{0, 50, 151} {
+		_, err := v.GetClockAtHistoryId(id)
+		if err == nil {
+			t.Fatalf("(%d) expected error but got nil\n", id)
+		}
+		if err != errHistoryNotAvailable {
+			t.Fatalf("(%d) unexpected error: expected %q, got %q\n", id, errHistoryNotAvailable.Error(), err.Error())
+		}
+	}
+}
+
+func TestForkAt(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	v.Tick("a")
+	v.Set("b", 5)
+	v.Tick("a")
+	v.Tick("b")
+
+	f, err := v.ForkAt(2, false)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer f.Close()
+
+	c, _ := f.GetClock()
+	if !reflect.DeepEqual(c, Clock{"a": 1, "b": 5}) {
+		t.Fatalf("unexpected clock: %v\n", c)
+	}
+
+	fh, err := v.ForkAt(2, true)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer fh.Close()
+
+	expected, _ := v.GetFullHistoryRange(0, 2)
+	history, err := fh.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(history, expected) {
+		t.Fatalf("unexpected history: expected %v, got %v\n", expected, history)
+	}
+
+	// The fork evolves independently of the original
+	if err := fh.Tick("b"); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	c, _ = fh.GetClockAtHistoryId(3)
+	if !reflect.DeepEqual(c, Clock{"a": 1, "b": 6}) {
+		t.Fatalf("unexpected clock: %v\n", c)
+	}
+	c, _ = v.GetClock()
+	if !reflect.DeepEqual(c, Clock{"a": 2, "b": 6}) {
+		t.Fatalf("unexpected clock: %v\n", c)
+	}
+
+	for _, keepHistory := range []bool{false, true} {
+		_, err := v.ForkAt(5, keepHistory)
+		if err == nil {
+			t.Fatal("expected error but got nil")
+		}
+		if err != errHistoryNotAvailable {
+			t.Fatalf("unexpected error: expected %q, got %q\n", errHistoryNotAvailable.Error(), err.Error())
+		}
+	}
+}
+
+func TestForkAtClosed(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	v.Close()
+
+	// Allow time for the Close() to complete
+	time.Sleep(1 * time.Millisecond)
+
+	for _, keepHistory := range []bool{false, true} {
+		_, err = v.ForkAt(0, keepHistory)
+		if err == nil {
+			t.Fatal("expected error but got nil")
+		}
+		if err != errClosedVClock {
+			t.Fatalf("unexpected error: expected %q, got %q\n", errClosedVClock.Error(), err.Error())
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "clock.wal")
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+	ts := WithTimeSource(func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	})
+
+	v, err := Open(ctx, path, "SHA256", ts)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	v.Set("a", 0)
+	v.SetWithMetadata("b", 2, map[string]string{"request": "r1"})
+	v.Tick("a")
+	v.MergeClock(Clock{"c": 3})
+	v.Receive("a", Clock{"b": 5})
+	v.Retire("c")
+	v.Update(func(tx *Tx) error {
+		if err := tx.Tick("b"); err != nil {
+			return err
+		}
+		return tx.Advance("a", 3)
+	})
+
+	// Failed updates are not logged
+	if err := v.Tick("x"); err != errAttemptToTickUnknownId {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errAttemptToTickUnknownId.Error(), err)
+	}
+
+	expected, err := v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.Close(); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	v, err = Open(ctx, path, "", ts)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	history, err := v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(history, expected) {
+		t.Fatalf("unexpected history: expected %v, got %v\n", expected, history)
+	}
+
+	retired, err := v.GetRetired()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(retired, Clock{"c": 3}) {
+		t.Fatalf("unexpected retired identifiers: %v\n", retired)
+	}
+
+	// Updates continue to be logged after recovery
+	if err := v.Tick("b"); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.Close(); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	v, err = Open(ctx, path, "", ts)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	// Updates are rejected once the log is closed, and closing again has no effect
+	if err := v.Close(); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.Close(); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if err := v.Tick("a"); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+
+	v, err = Open(ctx, path, "", ts)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	c, _ := v.GetClock()
+	if !reflect.DeepEqual(c, Clock{"a": 5, "b": 7}) {
+		t.Fatalf("unexpected clock: %v\n", c)
+	}
+	if id, _ := v.LatestHistoryId(); id != uint64(len(expected)) {
+		t.Fatalf("unexpected latest history id: %d\n", id)
+	}
+}
+
+func TestOpenTornTail(t *testing.T) {
+
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "clock.wal")
+
+	v, err := Open(ctx, path, "", WithSyncEvery(0))
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	v.Set("a", 0)
+	v.Tick("a")
+	if err := v.Close(); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	valid, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	// A record that fails its checksum, as if the final update was only partially written
+	v, err = Open(ctx, path, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	v.Tick("a")
+	if err := v.Close(); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	data[len(data)-1] ^= 0xff
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"partial header", append(append([]byte{}, valid...), 1, 2, 3)},
+		{"partial payload", append(append([]byte{}, valid...), data[len(valid):len(data)-5]...)},
+		{"bad checksum", data},
+		{"oversized length", append(append([]byte{}, valid...), 0xff, 0xff, 0xff, 0x7f, 0, 0, 0, 0)},
+	}
+
+	for _, test := range tests {
+		if err := os.WriteFile(path, test.data, 0o644); err != nil {
+			t.Fatalf("(%s) unexpected error %q\n", test.name, err.Error())
+		}
+
+		v, err := Open(ctx, path, "")
+		if err != nil {
+			t.Fatalf("(%s) unexpected error %q\n", test.name, err.Error())
+		}
+
+		c, _ := v.GetClock()
+		if !reflect.DeepEqual(c, Clock{"a": 1}) {
+			t.Fatalf("(%s) unexpected clock: %v\n", test.name, c)
+		}
+		if err := v.Close(); err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+
+		truncated, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("(%s) unexpected error %q\n", test.name, err.Error())
+		}
+		if !bytes.Equal(truncated, valid) {
+			t.Fatalf("(%s) torn tail not truncated: expected %d bytes, got %d\n", test.name, len(valid), len(truncated))
+		}
+	}
+
+	// An entirely torn log starts a new clock
+	if err := os.WriteFile(path, valid[:5], 0o644); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	v, err = Open(ctx, path, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	c, _ := v.GetClock()
+	if !reflect.DeepEqual(c, Clock{}) {
+		t.Fatalf("unexpected clock: %v\n", c)
+	}
+}
+
+func TestOpenClosesLog(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	path := filepath.Join(t.TempDir(), "clock.wal")
+
+	v, err := Open(ctx, path, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	v.Set("a", 0)
+
+	cancel()
+
+	if err := v.Tick("a"); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+
+	// The log has been, or is being, closed due to the context, so
+	// closing the VClock has nothing further to report
+	if err := v.Close(); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	v, err = Open(context.Background(), path, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	c, _ := v.GetClock()
+	if !reflect.DeepEqual(c, Clock{"a": 0}) {
+		t.Fatalf("unexpected clock: %v\n", c)
+	}
+
+	if _, err := Open(ctx, filepath.Join(t.TempDir(), "missing", "clock.wal"), ""); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+}
+
+func TestWalkHistory(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	for i := 0; i < 200; i++ {
+		v.Tick("a")
+	}
+	v.MergeClockWithMetadata(Clock{"b": 1}, map[string]string{"peer": "p1"})
+
+	expected, err := v.GetFullHistory()
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	for _, chunkSize := range []int{1, 7, 64, 201, 202, 1000} {
+		items := []*HistoryItem{}
+		err := v.WalkHistory(ctx, 0, chunkSize, func(item *HistoryItem) error {
+			items = append(items, item)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("(%d) unexpected error %q\n", chunkSize, err.Error())
+		}
+		if !reflect.DeepEqual(items, expected) {
+			t.Fatalf("(%d) unexpected items\n", chunkSize)
+		}
+	}
+
+	// Walk from a later HistoryId
+	items := []*HistoryItem{}
+	err = v.WalkHistory(ctx, 150, 10, func(item *HistoryItem) error {
+		items = append(items, item)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !reflect.DeepEqual(items, expected[150:]) {
+		t.Fatalf("unexpected items: %v\n", items)
+	}
+
+	// The function can stop the walk
+	errStop := errors.New("stop")
+	n := 0
+	err = v.WalkHistory(ctx, 0, 10, func(item *HistoryItem) error {
+		n++
+		if item.HistoryId == 25 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errStop.Error(), err)
+	}
+	if n != 26 {
+		t.Fatalf("unexpected number of items walked: %d\n", n)
+	}
+
+	// As can the context
+	wctx, cancel := context.WithCancel(ctx)
+	n = 0
+	err = v.WalkHistory(wctx, 0, 10, func(item *HistoryItem) error {
+		n++
+		if item.HistoryId == 25 {
+			cancel()
+		}
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error: expected %q, got %v\n", context.Canceled.Error(), err)
+	}
+	if n != 30 {
+		t.Fatalf("unexpected number of items walked: %d\n", n)
+	}
+
+	if err := v.WalkHistory(ctx, 0, 0, func(item *HistoryItem) error { return nil }); err != errChunkSizeMustBePositive {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errChunkSizeMustBePositive.Error(), err)
+	}
+	if err := v.WalkHistory(ctx, 0, 10, nil); err != errWalkFuncMustNotBeNil {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errWalkFuncMustNotBeNil.Error(), err)
+	}
+}
+
+func TestWalkHistoryConcurrentUpdates(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0}, "", WithMaxHistoryItems(50))
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	for i := 0; i < 40; i++ {
+		v.Tick("a")
+	}
+
+	// Updates made during the walk prune earlier items, which are skipped,
+	// and later items are not included
+	last := uint64(0)
+	err = v.WalkHistory(ctx, 0, 10, func(item *HistoryItem) error {
+		if item.HistoryId <= last && last != 0 {
+			t.Fatalf("unexpected order of items: %d after %d\n", item.HistoryId, last)
+		}
+		if item.Clock["a"] != item.HistoryId {
+			t.Fatalf("unexpected clock for item %d: %v\n", item.HistoryId, item.Clock)
+		}
+		last = item.HistoryId
+		return v.Tick("a")
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if last != 40 {
+		t.Fatalf("unexpected last item walked: %d\n", last)
+	}
+}
+
+func TestWalkHistoryClosed(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 0}, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	v.Close()
+
+	// Allow time for the Close() to complete
+	time.Sleep(1 * time.Millisecond)
+
+	err = v.WalkHistory(ctx, 0, 10, func(item *HistoryItem) error { return nil })
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if err != errClosedVClock {
+		t.Fatalf("unexpected error: expected %q, got %q\n", errClosedVClock.Error(), err.Error())
+	}
+}
+
+func TestClockPredicatesMatchVClock(t *testing.T) {
+
+	ctx := context.Background()
+
+	tests := []struct {
+		c1 Clock
+		c2 Clock
+	}{
+		{Clock{"a": 1, "b": 1}, Clock{"a": 1, "b": 1}},
+		{Clock{"a": 1, "b": 1}, Clock{"a": 2, "b": 1}},
+		{Clock{"a": 1, "b": 1}, Clock{"a": 1, "c": 1, "d": 1}},
+		{Clock{"a": 1, "c": 1, "d": 1}, Clock{"a": 1, "b": 1}},
+		{Clock{"a": 1, "b": 14}, Clock{"a": 2, "d": 12}},
+		{Clock{"a": 1}, Clock{"a": 1, "b": 0}},
+		{Clock{}, Clock{"a": 1}},
+	}
+
+	for i, test := range tests {
+		v1, err := New(ctx, test.c1, "")
+		if err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+		defer v1.Close()
+
+		v2, err := New(ctx, test.c2, "")
+		if err != nil {
+			t.Fatalf("unexpected error %q\n", err.Error())
+		}
+		defer v2.Close()
+
+		equal, _ := v1.Equal(v2)
+		concurrent, _ := v1.Concurrent(v2)
+		descends, _ := v1.DescendsFrom(v2)
+		ancestor, _ := v1.AncestorOf(v2)
+
+		if test.c1.Equal(test.c2) != equal {
+			t.Fatalf("(%d) Equal differs from VClock: %v\n", i, equal)
+		}
+		if test.c1.Concurrent(test.c2) != concurrent {
+			t.Fatalf("(%d) Concurrent differs from VClock: %v\n", i, concurrent)
+		}
+		if test.c1.DescendsFrom(test.c2) != descends {
+			t.Fatalf("(%d) DescendsFrom differs from VClock: %v\n", i, descends)
+		}
+		if test.c1.AncestorOf(test.c2) != ancestor {
+			t.Fatalf("(%d) AncestorOf differs from VClock: %v\n", i, ancestor)
+		}
+	}
+}
+
+func TestNewFromHistoryMalformed(t *testing.T) {
+
+	ctx := context.Background()
+
+	first := &HistoryItem{Clock: Clock{"a": 0}}
+
+	tests := []struct {
+		items []*HistoryItem
+		id    uint64
+	}{
+		{[]*HistoryItem{first, {HistoryId: 1, Change: &Event{Type: Set}}}, 1},
+		{[]*HistoryItem{first, {HistoryId: 1, Change: &Event{Type: SetMax}}}, 1},
+		{[]*HistoryItem{first, {HistoryId: 1, Change: &Event{Type: Advance}}}, 1},
+		{[]*HistoryItem{first, {HistoryId: 1, Change: &Event{Type: Transaction, Events: []*Event{nil}}}}, 1},
+		{[]*HistoryItem{first, {HistoryId: 1, Change: &Event{Type: Transaction, Events: []*Event{{Type: Tick, Tick: "a"}, {Type: Set}}}}}, 1},
+		{[]*HistoryItem{first, {HistoryId: 1, Change: &Event{Type: 0}}}, 1},
+		{[]*HistoryItem{{HistoryId: 4, Clock: Clock{"a": 0}, Change: &Event{Type: Advance}}}, 4},
+	}
+
+	for i, test := range tests {
+		_, err := NewFromHistory(ctx, test.items, "")
+		if err == nil {
+			t.Fatalf("(%d) expected error but got nil\n", i)
+		}
+
+		var d *HistoryDivergenceError
+		if !errors.As(err, &d) {
+			t.Fatalf("(%d) unexpected error type: %v\n", i, err)
+		}
+		if d.HistoryId != test.id {
+			t.Fatalf("(%d) unexpected divergence: expected %d, got %d\n", i, test.id, d.HistoryId)
+		}
+		if !errors.Is(err, errEventIsMalformed) {
+			t.Fatalf("(%d) unexpected error: expected %q, got %q\n", i, errEventIsMalformed.Error(), err.Error())
+		}
+	}
+}
+
+func TestForkAtRetainsTombstones(t *testing.T) {
+
+	ctx := context.Background()
+
+	v, err := NewWithHistory(ctx, Clock{"a": 3, "b": 0}, "SHA256")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer v.Close()
+
+	v.Retire("a") // 1
+	if err := v.Prune(); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	v.Tick("b")      // 2
+	v.Retire("b")    // 3
+	v.SetMax("a", 5) // 4
+	v.Set("c", 0)    // 5
+
+	tests := []struct {
+		id      uint64
+		retired Clock
+	}{
+		{1, Clock{"a": 3}},
+		{2, Clock{"a": 3}},
+		{3, Clock{"a": 3, "b": 1}},
+		{4, Clock{"b": 1}},
+		{5, Clock{"b": 1}},
+	}
+
+	for _, test := range tests {
+		for _, keepHistory := range []bool{false, true} {
+			f, err := v.ForkAt(test.id, keepHistory)
+			if err != nil {
+				t.Fatalf("(%d, %v) unexpected error %q\n", test.id, keepHistory, err.Error())
+			}
+			defer f.Close()
+
+			retired, err := f.GetRetired()
+			if err != nil {
+				t.Fatalf("(%d, %v) unexpected error %q\n", test.id, keepHistory, err.Error())
+			}
+			if !reflect.DeepEqual(retired, test.retired) {
+				t.Fatalf("(%d, %v) unexpected retired identifiers: expected %v, got %v\n", test.id, keepHistory, test.retired, retired)
+			}
+
+			// Retired identifiers are not reintroduced by merges
+			expected, _ := v.GetClockAtHistoryId(test.id)
+			if err := f.MergeClock(Clock{"a": 9, "b": 9}); err != nil {
+				t.Fatalf("(%d, %v) unexpected error %q\n", test.id, keepHistory, err.Error())
+			}
+			for id := range test.retired {
+				if _, ok := expected[id]; ok {
+					t.Fatalf("(%d, %v) retired identifier %q present in clock: %v\n", test.id, keepHistory, id, expected)
+				}
+			}
+			c, _ := f.GetClock()
+			for id := range c {
+				if _, ok := test.retired[id]; ok {
+					t.Fatalf("(%d, %v) retired identifier %q reintroduced: %v\n", test.id, keepHistory, id, c)
+				}
+			}
+		}
+	}
+}
+
+func TestOpenCorruptLog(t *testing.T) {
+
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "clock.wal")
+
+	v, err := Open(ctx, path, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	v.Set("a", 0)
+	if err := v.Close(); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	valid, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	v, err = Open(ctx, path, "")
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	v.Tick("a")
+	v.Tick("a")
+	if err := v.Close(); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	// Corrupt the first of the Tick records, which is followed by the second
+	data[len(valid)+walHeaderSize+2] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	_, err = Open(ctx, path, "")
+	if err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if err != errWALCorrupt {
+		t.Fatalf("unexpected error: expected %q, got %q\n", errWALCorrupt.Error(), err.Error())
+	}
+
+	// The log is left unaltered
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	if !bytes.Equal(after, data) {
+		t.Fatalf("corrupt log was altered: expected %d bytes, got %d\n", len(data), len(after))
+	}
+}
+
+func TestWALAppendFailure(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "clock.wal")
+
+	f, _, offset, err := openWAL(path)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	w := &wal{f: f, offset: offset, syncEvery: 1}
+
+	shortener, _ := GetShortenerFactory().Get("NoOp")
+	h := newHistory(Clock{"a": 0}, shortener, true, time.Now)
+	if err := w.append(&walRecord{Clock: Clock{"a": 0}}); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	h.wal = w
+
+	if err := h.apply(&Event{Type: Tick, Tick: "a"}); err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+
+	// Closing the file underneath the log causes the write to fail, and
+	// as the file cannot be restored no further updates are accepted
+	f.Close()
+
+	if err := h.apply(&Event{Type: Tick, Tick: "a"}); err == nil {
+		t.Fatal("expected error but got nil")
+	}
+	if err := h.apply(&Event{Type: Tick, Tick: "a"}); err != errWALFailed {
+		t.Fatalf("unexpected error: expected %q, got %v\n", errWALFailed.Error(), err)
+	}
+
+	if h.getLastId() != 1 || !reflect.DeepEqual(h.latest(), Clock{"a": 1}) {
+		t.Fatalf("unexpected history after failure: %d %v\n", h.getLastId(), h.latest())
+	}
+
+	// The log remains readable, holding only the updates that were applied
+	f, records, _, err := openWAL(path)
+	if err != nil {
+		t.Fatalf("unexpected error %q\n", err.Error())
+	}
+	defer f.Close()
+
+	if len(records) != 2 || records[1].HistoryId != 1 {
+		t.Fatalf("unexpected records: %v\n", records)
+	}
+}
@@ -1,7 +1,5 @@
 package vclock
 
-import "github.com/gford1000-go/syncmap"
-
 // condition constants define how to compare a vector clock against another,
 // and may be ORed together when being provided to the Compare method.
 type condition int
@@ -14,83 +12,147 @@ const (
 	concurrent                       // Clocks are completely independent, or partial overlap
 )
 
+// Ordering describes the causal relationship of another vector clock
+// to this one, as determined by a single evaluation of both clocks.
+type Ordering int
+
+// Ordering values share their representation with the comparison conditions
+const (
+	Equal      = Ordering(equal)      // Clocks are identical
+	Ancestor   = Ordering(ancestor)   // The other clock is an ancestor of this clock
+	Descendant = Ordering(descendant) // The other clock is a descendant of this clock
+	Concurrent = Ordering(concurrent) // Clocks are causally concurrent
+)
+
+func (o Ordering) String() string {
+	switch o {
+	case Equal:
+		return "Equal"
+	case Ancestor:
+		return "Ancestor"
+	case Descendant:
+		return "Descendant"
+	case Concurrent:
+		return "Concurrent"
+	}
+	return "Unknown"
+}
+
+// CompareMode determines how identifiers that are present in only
+// one of the clocks are treated during comparisons
+type CompareMode int
+
+const (
+	StrictCompare      CompareMode = iota // Identifiers absent from one clock are considered distinct from zero
+	ZeroDefaultCompare                    // Identifiers absent from one clock are considered to have the value zero
+)
+
+func (m CompareMode) String() string {
+	switch m {
+	case StrictCompare:
+		return "Strict"
+	case ZeroDefaultCompare:
+		return "ZeroDefault"
+	}
+	return "Unknown"
+}
+
+type reqOrdering struct {
+	other map[string]uint64
+	mode  CompareMode
+	ids   []string
+}
+
 type respComp struct {
 	other map[string]uint64
 	cond  condition
+	mode  CompareMode
 }
 
-// Compare takes another clock and determines if it is equal, an
-// ancestor, descendant, or concurrent with the callees clock.
-func compare(vc, other map[string]uint64, cond condition) bool {
+// compareWithMode returns true if the relationship of other to vc, as
+// determined using the specified mode, satisfies any of the conditions
+func compareWithMode(vc, other map[string]uint64, cond condition, mode CompareMode) bool {
+	return cond&condition(orderingWithMode(vc, other, mode)) != 0
+}
 
-	var otherIs condition
-	// Preliminary qualification based on length
-	if len(vc) > len(other) {
-		if cond&(ancestor|concurrent) == 0 {
-			return false
-		}
-		otherIs = ancestor
-	} else if len(vc) < len(other) {
-		if cond&(descendant|concurrent) == 0 {
-			return false
+// ordering determines the relationship of the other clock to vc in a single pass.
+// An identifier that is missing from one clock means the other clock is ahead
+// for that identifier.
+func ordering(vc, other map[string]uint64) Ordering {
+	vcAhead, otherAhead := false, false
+
+	matched := 0
+	for id, v := range vc {
+		if o, found := other[id]; found {
+			matched++
+			if o > v {
+				otherAhead = true
+			} else if o < v {
+				vcAhead = true
+			}
+		} else {
+			vcAhead = true
 		}
-		otherIs = descendant
-	} else {
-		otherIs = equal
+	}
+	if matched < len(other) {
+		otherAhead = true
 	}
 
-	keys := syncmap.SortedKeys(vc)
-	otherKeys := syncmap.SortedKeys(other)
+	return toOrdering(vcAhead, otherAhead)
+}
 
-	if cond&(equal|descendant) != 0 {
-		// All of the identifiers in this clock must be present in the other
-		for _, key := range keys {
-			if _, ok := other[key]; !ok {
-				return false
-			}
+// orderingZeroDefault determines the relationship of the other clock to vc in a
+// single pass, treating an identifier that is missing from one clock as zero
+func orderingZeroDefault(vc, other map[string]uint64) Ordering {
+	vcAhead, otherAhead := false, false
+
+	for id, v := range vc {
+		if o := other[id]; o > v {
+			otherAhead = true
+		} else if o < v {
+			vcAhead = true
 		}
 	}
-	if cond&(equal|ancestor) != 0 {
-		// All of the identifiers in this clock must be present in the other
-		for _, key := range otherKeys {
-			if _, ok := vc[key]; !ok {
-				return false
-			}
+	for id, o := range other {
+		if _, found := vc[id]; !found && o > 0 {
+			otherAhead = true
 		}
 	}
 
-	// Compare matching items, using sortedKeys to provide
-	// deterministic (sorted) comparison of lock identifiers
-	for _, id := range otherKeys {
-		if _, found := vc[id]; found {
-			if other[id] > vc[id] {
-				switch otherIs {
-				case equal:
-					if cond&descendant == 0 {
-						return false
-					}
-					otherIs = descendant
-				case ancestor:
-					return cond&concurrent != 0
-				}
-			} else if other[id] < vc[id] {
-				switch otherIs {
-				case equal:
-					if cond&ancestor == 0 {
-						return false
-					}
-					otherIs = ancestor
-				case descendant:
-					return cond&concurrent != 0
-				}
-			}
-		} else {
-			if otherIs == equal {
-				return cond&concurrent != 0
-			} else if (len(other) - len(vc) - 1) < 0 {
-				return cond&concurrent != 0
-			}
-		}
+	return toOrdering(vcAhead, otherAhead)
+}
+
+// orderingWithMode determines the relationship of the other clock to vc
+// using the specified mode
+func orderingWithMode(vc, other map[string]uint64, mode CompareMode) Ordering {
+	if mode == ZeroDefaultCompare {
+		return orderingZeroDefault(vc, other)
+	}
+	return ordering(vc, other)
+}
+
+// toOrdering returns the Ordering given which of the clocks are
+// ahead of the other for at least one identifier
+func toOrdering(vcAhead, otherAhead bool) Ordering {
+	switch {
+	case vcAhead && otherAhead:
+		return Concurrent
+	case otherAhead:
+		return Descendant
+	case vcAhead:
+		return Ancestor
 	}
-	return cond&otherIs != 0
+	return Equal
+}
+
+// Compare determines the relationship of the other clock to this clock,
+// so that Descendant is returned if the other clock descends from this clock
+func (c Clock) Compare(other Clock) Ordering {
+	return ordering(c, other)
+}
+
+// CompareWithMode determines the relationship of the other clock to this clock,
+// using the specified CompareMode
+func (c Clock) CompareWithMode(other Clock, mode CompareMode) Ordering {
+	return orderingWithMode(c, other, mode)
 }
@@ -0,0 +1,182 @@
+package vclock
+
+import "github.com/gford1000-go/syncmap"
+
+// Relation describes how the value of an identifier in one clock
+// relates to its value in another clock
+type Relation int
+
+const (
+	Same       Relation = iota // Identifier has the same value in both clocks
+	Ahead                      // Identifier has a greater value in this clock
+	Behind                     // Identifier has a greater value in the other clock
+	LocalOnly                  // Identifier is only present in this clock
+	RemoteOnly                 // Identifier is only present in the other clock
+)
+
+func (r Relation) String() string {
+	switch r {
+	case Same:
+		return "Same"
+	case Ahead:
+		return "Ahead"
+	case Behind:
+		return "Behind"
+	case LocalOnly:
+		return "LocalOnly"
+	case RemoteOnly:
+		return "RemoteOnly"
+	}
+	return "Unknown"
+}
+
+// IdentifierDiff reports the values of an identifier in this (local) clock
+// and the other (remote) clock.  A value is zero if the identifier is absent.
+type IdentifierDiff struct {
+	Id       string
+	Local    uint64
+	Remote   uint64
+	Relation Relation
+}
+
+type reqDiff struct {
+	other Clock
+}
+
+type respDiff struct {
+	d []IdentifierDiff
+	e error
+}
+
+// diff returns the relationship of each identifier across both clocks,
+// sorted by identifier
+func diff(vc, other map[string]uint64) []IdentifierDiff {
+	ids := map[string]bool{}
+	for id := range vc {
+		ids[id] = true
+	}
+	for id := range other {
+		ids[id] = true
+	}
+
+	ret := make([]IdentifierDiff, 0, len(ids))
+	for _, id := range syncmap.SortedKeys(ids) {
+		local, inLocal := vc[id]
+		remote, inRemote := other[id]
+
+		d := IdentifierDiff{Id: id, Local: local, Remote: remote}
+		switch {
+		case !inRemote:
+			d.Relation = LocalOnly
+		case !inLocal:
+			d.Relation = RemoteOnly
+		case local > remote:
+			d.Relation = Ahead
+		case local < remote:
+			d.Relation = Behind
+		default:
+			d.Relation = Same
+		}
+		ret = append(ret, d)
+	}
+	return ret
+}
+
+// Diff reports the relationship of each identifier in either this
+// Clock or the other Clock, sorted by identifier
+func (c Clock) Diff(other Clock) []IdentifierDiff {
+	return diff(c, other)
+}
+
+// Diff reports the relationship of each identifier in either this clock
+// or the other clock, sorted by identifier.  As with comparisons, retired
+// identifiers of this clock are ignored within the other clock.
+func (vc *VClock) Diff(other *VClock) ([]IdentifierDiff, error) {
+	if other == nil {
+		return nil, errClockMustNotBeNil
+	}
+
+	m, err := other.GetClock()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := attemptSendWithResp[*reqDiff, *respDiff](vc.backend, &reqDiff{other: m})
+	if err != nil {
+		return nil, err
+	}
+	if resp.e != nil {
+		return nil, resp.e
+	}
+	return resp.d, nil
+}
+
+// Distance quantifies the number of events by which this clock is behind,
+// or ahead of, another clock.  Identifiers absent from a clock are
+// considered to be zero.
+type Distance struct {
+	Behind      Clock  // For each identifier, the number of events this clock is behind the other clock
+	Ahead       Clock  // For each identifier, the number of events this clock is ahead of the other clock
+	TotalBehind uint64 // Sum of the Behind values
+	TotalAhead  uint64 // Sum of the Ahead values
+}
+
+type reqLag struct {
+	other Clock
+}
+
+type respLag struct {
+	d *Distance
+	e error
+}
+
+// lag calculates the Distance of vc from the other clock
+func lag(vc, other map[string]uint64) *Distance {
+	d := &Distance{
+		Behind: Clock{},
+		Ahead:  Clock{},
+	}
+	for id, v := range vc {
+		if o := other[id]; v > o {
+			d.Ahead[id] = v - o
+			d.TotalAhead += v - o
+		} else if v < o {
+			d.Behind[id] = o - v
+			d.TotalBehind += o - v
+		}
+	}
+	for id, o := range other {
+		if _, found := vc[id]; !found && o > 0 {
+			d.Behind[id] = o
+			d.TotalBehind += o
+		}
+	}
+	return d
+}
+
+// Lag returns the Distance of this Clock from the other Clock
+func (c Clock) Lag(other Clock) Distance {
+	return *lag(c, other)
+}
+
+// Lag returns the Distance of this clock from the other clock.  As with
+// comparisons, retired identifiers of this clock are ignored within the other clock.
+func (vc *VClock) Lag(other *VClock) (Distance, error) {
+	if other == nil {
+		return Distance{}, errClockMustNotBeNil
+	}
+
+	m, err := other.GetClock()
+	if err != nil {
+		return Distance{}, err
+	}
+
+	resp, err := attemptSendWithResp[*reqLag, *respLag](vc.backend, &reqLag{other: m})
+	if err != nil {
+		return Distance{}, err
+	}
+	if resp.e != nil {
+		return Distance{}, resp.e
+	}
+	return *resp.d, nil
+}
@@ -188,7 +188,10 @@ func ExampleGetHistory() {
 func ExampleGetFullHistory() {
 	ctx := context.Background()
 
-	c1, _ := NewWithHistory(ctx, Clock{"x": 0, "y": 0}, "")
+	// Use a fixed time source so that the output is reproducible
+	ts := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	c1, _ := NewWithHistory(ctx, Clock{"x": 0, "y": 0}, "", WithTimeSource(func() time.Time { return ts }))
 	defer c1.Close()
 
 	c1.Tick("x")
@@ -205,7 +208,7 @@ func ExampleGetFullHistory() {
 	history, _ := c1.GetFullHistory()
 
 	fmt.Println(history)
-	// Output: [{0 <nil> map[x:0 y:0]} {1 {Tick <nil> x map[]} map[x:1 y:0]} {2 {Tick <nil> x map[]} map[x:2 y:0]} {3 {Tick <nil> y map[]} map[x:2 y:1]} {4 {Tick <nil> x map[]} map[x:3 y:1]} {5 {Merge <nil>  map[z:7]} map[x:3 y:1 z:7]}]
+	// Output: [{0 <nil> map[x:0 y:0] 2024-01-01 00:00:00 +0000 UTC} {1 {Tick <nil> x map[] []  map[]} map[x:1 y:0] 2024-01-01 00:00:00 +0000 UTC} {2 {Tick <nil> x map[] []  map[]} map[x:2 y:0] 2024-01-01 00:00:00 +0000 UTC} {3 {Tick <nil> y map[] []  map[]} map[x:2 y:1] 2024-01-01 00:00:00 +0000 UTC} {4 {Tick <nil> x map[] []  map[]} map[x:3 y:1] 2024-01-01 00:00:00 +0000 UTC} {5 {Merge <nil>  map[z:7] []  map[]} map[x:3 y:1 z:7] 2024-01-01 00:00:00 +0000 UTC}]
 }
 
 func ExamplePrune() {
@@ -242,3 +245,39 @@ func ExampleContextCancelled() {
 	fmt.Println(err)
 	// Output: attempt to interact with closed clock
 }
+
+func ExampleVClock_Update() {
+	ctx := context.Background()
+
+	c, _ := NewWithHistory(ctx, Clock{"x": 0}, "")
+	defer c.Close()
+
+	// Join a new participant and tick ourselves as a single change
+	c.Update(func(tx *Tx) error {
+		if err := tx.Set("y", 0); err != nil {
+			return err
+		}
+		return tx.Tick("x")
+	})
+
+	history, _ := c.GetHistory()
+	fmt.Println(history)
+	// Output: [map[x:0] map[x:1 y:0]]
+}
+
+func ExampleVClock_MergeWithMetadata() {
+	ctx := context.Background()
+
+	c1, _ := NewWithHistory(ctx, Clock{"x": 0}, "")
+	defer c1.Close()
+
+	c2, _ := New(ctx, Clock{"y": 3}, "")
+	defer c2.Close()
+
+	// Record why the merge took place, for later inspection of the history
+	c1.MergeWithMetadata(c2, map[string]string{"peer": "c2", "message": "m-42"})
+
+	history, _ := c1.GetFullHistory()
+	fmt.Println(history[1].Change.Metadata)
+	// Output: map[message:m-42 peer:c2]
+}
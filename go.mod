@@ -5,5 +5,3 @@ go 1.21.1
 require golang.org/x/exp v0.0.0-20231006140011-7918f672742d
 
 require github.com/gford1000-go/syncmap v1.0.0
-
-require github.com/gford1000-go/chant v1.0.0
@@ -0,0 +1,107 @@
+package vclock
+
+import "time"
+
+// Option allows the behaviour of a VClock to be configured on construction
+type Option func(*options)
+
+// options holds the configuration of a VClock
+type options struct {
+	backend     Backend
+	compareMode CompareMode
+	retention   retention
+	now         func() time.Time
+	syncEvery   int
+}
+
+// defaultBackend is used when no backend is specified by an Option
+var defaultBackend = ChannelBackend
+
+// newOptions applies the supplied Options over the defaults
+func newOptions(opts []Option) *options {
+	o := &options{
+		backend:   defaultBackend,
+		now:       time.Now,
+		syncEvery: 1,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return o
+}
+
+// WithBackend selects the Backend used to serialise access to the VClock.
+// The default is ChannelBackend.
+func WithBackend(b Backend) Option {
+	return func(o *options) {
+		o.backend = b
+	}
+}
+
+// WithCompareMode selects the CompareMode used by Compare, Equal, Concurrent,
+// DescendsFrom and AncestorOf.  The default is StrictCompare.
+func WithCompareMode(m CompareMode) Option {
+	return func(o *options) {
+		o.compareMode = m
+	}
+}
+
+// WithMaxHistoryItems limits the history of a VClock to the specified number
+// of items, discarding the earliest items once the limit is exceeded.
+// This has no effect unless history is being maintained.
+func WithMaxHistoryItems(n int) Option {
+	return func(o *options) {
+		o.retention.maxItems = n
+	}
+}
+
+// WithMaxHistoryAge limits the history of a VClock to items applied within
+// the specified duration, discarding older items as new updates are applied.
+// This has no effect unless history is being maintained.
+func WithMaxHistoryAge(d time.Duration) Option {
+	return func(o *options) {
+		o.retention.maxAge = d
+	}
+}
+
+// WithMaxHistoryBytes limits the history of a VClock to approximately the
+// specified number of bytes, discarding the earliest items once the limit
+// is exceeded.  This has no effect unless history is being maintained.
+func WithMaxHistoryBytes(n int) Option {
+	return func(o *options) {
+		o.retention.maxBytes = n
+	}
+}
+
+// WithHistoryPruned provides a function that is called with the range of
+// HistoryIds discarded whenever history is pruned, either by Prune or due
+// to the retention limits.  The function is called whilst access to the
+// clock is serialised, and so must not call any methods of the VClock.
+func WithHistoryPruned(f func(from, to uint64)) Option {
+	return func(o *options) {
+		o.retention.onPruned = f
+	}
+}
+
+// WithTimeSource provides the function used to timestamp each HistoryItem,
+// and to determine the age of items for WithMaxHistoryAge.
+// The default is time.Now.
+func WithTimeSource(now func() time.Time) Option {
+	return func(o *options) {
+		if now != nil {
+			o.now = now
+		}
+	}
+}
+
+// WithSyncEvery sets the number of updates appended to the write-ahead log of
+// a VClock created by Open before the log is synchronised to storage.  The
+// default of 1 synchronises every update, whilst 0 leaves synchronisation to
+// the operating system until the VClock is closed.
+func WithSyncEvery(n int) Option {
+	return func(o *options) {
+		o.syncEvery = n
+	}
+}
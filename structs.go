@@ -1,6 +1,13 @@
 package vclock
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+var errEventIsMalformed = errors.New("event does not hold the details required by its type")
 
 // SetInfo stores the value to be applied to the vector clock
 // for the specified identifier.
@@ -29,6 +36,16 @@ func (e EventType) String() string {
 		return "Tick"
 	case Merge:
 		return "Merge"
+	case Receive:
+		return "Receive"
+	case Transaction:
+		return "Transaction"
+	case Retire:
+		return "Retire"
+	case SetMax:
+		return "SetMax"
+	case Advance:
+		return "Advance"
 	}
 	return "Unknown"
 }
@@ -37,35 +54,91 @@ const (
 	Set EventType = 1 << iota
 	Tick
 	Merge
+	Receive
+	Transaction
+	Retire
+	SetMax
+	Advance
 )
 
 // Event captures the details of a specific update to the vector clock.
-// Only one of the attributes will contain information.
+// Only one of the attributes will contain information, other than for
+// Receive, which merges the Merge clock and then ticks the Tick identifier.
+// SetMax and Advance use the Set attribute, with Advance adding its Value.
+// A Transaction holds the Events that were applied together.
+// Metadata optionally records caller supplied details of why the
+// update was made, such as a message or request identifier.
 type Event struct {
-	Type  EventType
-	Set   *SetInfo
-	Tick  string
-	Merge Clock
+	Type     EventType
+	Set      *SetInfo
+	Tick     string
+	Merge    Clock
+	Events   []*Event
+	Retire   string
+	Metadata map[string]string
 }
 
 func (e *Event) String() string {
 	return fmt.Sprint(*e)
 }
 
+// validate checks that the details required by the type of the event are
+// present, so that it can be copied and applied
+func (e *Event) validate() error {
+	switch e.Type {
+	case Set, SetMax, Advance:
+		if e.Set == nil {
+			return errEventIsMalformed
+		}
+	case Tick, Merge, Receive, Retire:
+	case Transaction:
+		for _, ev := range e.Events {
+			if ev == nil {
+				return errEventIsMalformed
+			}
+			if err := ev.validate(); err != nil {
+				return err
+			}
+		}
+	default:
+		return errEventIsMalformed
+	}
+	return nil
+}
+
 // copy returns a deep copy of the instance
 func (e *Event) copy() *Event {
 	ret := &Event{Type: e.Type}
 	switch e.Type {
-	case Set:
+	case Set, SetMax, Advance:
 		ret.Set = e.Set.copy()
 	case Tick:
 		ret.Tick = e.Tick
 	case Merge:
 		ret.Merge = copyMap(e.Merge)
+	case Receive:
+		ret.Tick = e.Tick
+		ret.Merge = copyMap(e.Merge)
+	case Transaction:
+		ret.Events = make([]*Event, len(e.Events))
+		for i, ev := range e.Events {
+			ret.Events[i] = ev.copy()
+		}
+	case Retire:
+		ret.Retire = e.Retire
 	}
+	ret.Metadata = copyMetadata(e.Metadata)
 	return ret
 }
 
+// copyMetadata returns a copy of the metadata, retaining nil if not provided
+func copyMetadata(md map[string]string) map[string]string {
+	if md == nil {
+		return nil
+	}
+	return copyMap(md)
+}
+
 // apply attempts to assign the change to the supplied map,
 // transforming the identifiers using the supplied function
 func (e *Event) apply(m Clock, f func(string) string) error {
@@ -80,34 +153,162 @@ func (e *Event) apply(m Clock, f func(string) string) error {
 			return errAttemptToSetExistingId
 		}
 		m[id] = e.Set.Value
+	case SetMax:
+		if len(e.Set.Id) == 0 {
+			return errClockIdMustNotBeEmptyString
+		}
+
+		id := f(e.Set.Id)
+		if v, ok := m[id]; !ok || v < e.Set.Value {
+			m[id] = e.Set.Value
+		}
+	case Advance:
+		if len(e.Set.Id) == 0 {
+			return errClockIdMustNotBeEmptyString
+		}
+
+		id := f(e.Set.Id)
+		v, ok := m[id]
+		if !ok {
+			return errAttemptToAdvanceUnknownId
+		}
+		if v > math.MaxUint64-e.Set.Value {
+			return errAttemptToOverflowId
+		}
+		m[id] = v + e.Set.Value
 	case Tick:
+		return tick(m, f(e.Tick))
+	case Merge:
+		merge(m, e.Merge, f)
+	case Receive:
+		if len(e.Tick) == 0 {
+			return errClockIdMustNotBeEmptyString
+		}
+
+		// Verify before merging, so that m is unaltered on error
 		id := f(e.Tick)
 		if _, ok := m[id]; !ok {
-			return errAttemptToTickUnknownId
+			if _, ok := e.Merge[e.Tick]; !ok {
+				return errAttemptToTickUnknownId
+			}
 		}
-
+		merge(m, e.Merge, f)
 		m[id] += 1
+	case Transaction:
+		for _, ev := range e.Events {
+			if err := ev.apply(m, f); err != nil {
+				return err
+			}
+		}
+	case Retire:
+		if len(e.Retire) == 0 {
+			return errClockIdMustNotBeEmptyString
+		}
+
+		id := f(e.Retire)
+		if _, ok := m[id]; !ok {
+			return errAttemptToRetireUnknownId
+		}
+		delete(m, id)
+	}
+	return nil
+}
+
+// touches returns true if the event refers to the (unshortened) identifier
+func (e *Event) touches(id string) bool {
+	switch e.Type {
+	case Set, SetMax, Advance:
+		return e.Set.Id == id
+	case Tick:
+		return e.Tick == id
 	case Merge:
+		_, ok := e.Merge[id]
+		return ok
+	case Receive:
+		_, ok := e.Merge[id]
+		return ok || e.Tick == id
+	case Transaction:
+		for _, ev := range e.Events {
+			if ev.touches(id) {
+				return true
+			}
+		}
+	case Retire:
+		return e.Retire == id
+	}
+	return false
+}
+
+// withoutIds returns the event with the identifiers for which the function
+// returns true removed from any clock that is to be merged.  The event is
+// returned unaltered if no identifiers are removed.
+func (e *Event) withoutIds(f func(string) bool) *Event {
+	switch e.Type {
+	case Merge, Receive:
+		var m Clock
 		for id := range e.Merge {
-			nid := f(id)
-			if _, ok := m[nid]; ok {
-				if m[nid] < e.Merge[id] {
-					m[nid] = e.Merge[id]
+			if f(id) {
+				if m == nil {
+					m = copyMap(e.Merge)
+				}
+				delete(m, id)
+			}
+		}
+		if m != nil {
+			ret := e.copy()
+			ret.Merge = m
+			return ret
+		}
+	case Transaction:
+		var events []*Event
+		for i, ev := range e.Events {
+			if nev := ev.withoutIds(f); nev != ev {
+				if events == nil {
+					events = append([]*Event{}, e.Events...)
 				}
-			} else {
-				m[nid] = e.Merge[id]
+				events[i] = nev
 			}
 		}
+		if events != nil {
+			return &Event{Type: Transaction, Events: events, Metadata: e.Metadata}
+		}
 	}
+	return e
+}
+
+// tick increments the value of the (transformed) identifier
+func tick(m Clock, id string) error {
+	if _, ok := m[id]; !ok {
+		return errAttemptToTickUnknownId
+	}
+
+	m[id] += 1
 	return nil
 }
 
+// merge assigns the maximum of each identifier value in m and other,
+// transforming the identifiers of other using the supplied function
+func merge(m Clock, other Clock, f func(string) string) {
+	for id := range other {
+		nid := f(id)
+		if _, ok := m[nid]; ok {
+			if m[nid] < other[id] {
+				m[nid] = other[id]
+			}
+		} else {
+			m[nid] = other[id]
+		}
+	}
+}
+
 // HistoryItem stores details of a state change due to the specified Event,
-// and holds the updated clock after the Event has been applied.
+// and holds the updated clock after the Event has been applied, together
+// with the time at which the Event was applied.
 type HistoryItem struct {
 	HistoryId uint64
 	Change    *Event
 	Clock     Clock
+	Time      time.Time
 }
 
 // copy returns a deep copy of the instance
@@ -115,6 +316,7 @@ func (h *HistoryItem) copy() *HistoryItem {
 	hi := &HistoryItem{
 		HistoryId: h.HistoryId,
 		Clock:     copyMap(h.Clock),
+		Time:      h.Time,
 	}
 
 	if h.Change != nil {
@@ -134,6 +336,7 @@ func (h *HistoryItem) copyWithKeyModification(f func(string) (string, error)) (*
 	hi := &HistoryItem{
 		HistoryId: h.HistoryId,
 		Clock:     m,
+		Time:      h.Time,
 	}
 
 	if h.Change != nil {
@@ -142,6 +345,54 @@ func (h *HistoryItem) copyWithKeyModification(f func(string) (string, error)) (*
 	return hi, nil
 }
 
+// withClock returns a shallow copy of the instance, holding the specified Clock
+func (h *HistoryItem) withClock(c Clock) *HistoryItem {
+	return &HistoryItem{
+		HistoryId: h.HistoryId,
+		Change:    h.Change,
+		Clock:     c,
+		Time:      h.Time,
+	}
+}
+
+// approxSize returns an approximation of the memory used by the instance,
+// where only checkpoint items hold a Clock
+func (h *HistoryItem) approxSize() int {
+	size := 64
+	if h.Clock != nil {
+		size += clockSize(h.Clock)
+	}
+	if h.Change != nil {
+		size += h.Change.approxSize()
+	}
+	return size
+}
+
+// approxSize returns an approximation of the memory used by the instance
+func (e *Event) approxSize() int {
+	size := 64 + clockSize(e.Merge) + len(e.Tick) + len(e.Retire)
+	if e.Set != nil {
+		size += 16 + len(e.Set.Id)
+	}
+	for _, ev := range e.Events {
+		size += ev.approxSize()
+	}
+	for k, v := range e.Metadata {
+		size += len(k) + len(v) + 32
+	}
+	return size
+}
+
+// clockSize returns an approximation of the memory used by the Clock,
+// being the identifiers and values plus an allowance for the map overhead
+func clockSize(c Clock) int {
+	size := 48
+	for id := range c {
+		size += len(id) + 8 + 16
+	}
+	return size
+}
+
 func (h *HistoryItem) String() string {
 	return fmt.Sprint(*h)
 }
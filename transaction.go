@@ -0,0 +1,97 @@
+package vclock
+
+import "errors"
+
+var errTransactionFuncMustNotBeNil = errors.New("transaction function must not be nil")
+
+// Tx provides the updates that can be applied within a transaction.
+// Each update is applied immediately to the working copy of the clock
+// held by the transaction, so that subsequent updates and Get observe
+// its effect, but no update is visible outside of the transaction until
+// it has completed successfully.
+type Tx struct {
+	c      Clock
+	f      func(string) string
+	filter func(*Event) *Event
+	events []*Event
+	err    error
+}
+
+// fail records the first error, so that the transaction is always rolled back
+func (tx *Tx) fail(err error) error {
+	if tx.err == nil {
+		tx.err = err
+	}
+	return tx.err
+}
+
+// apply attempts the event against the working copy
+func (tx *Tx) apply(event *Event) error {
+	if tx.err != nil {
+		return tx.err
+	}
+	event = tx.filter(event)
+	if err := event.apply(tx.c, tx.f); err != nil {
+		return tx.fail(err)
+	}
+	tx.events = append(tx.events, event)
+	return nil
+}
+
+// Set assigns the specified value to the given clock identifier,
+// with the same rules as VClock.Set
+func (tx *Tx) Set(id string, v uint64) error {
+	return tx.apply(&Event{Type: Set, Set: &SetInfo{Id: id, Value: v}})
+}
+
+// SetMax assigns the value to the given clock identifier if absent or
+// lower, with the same rules as VClock.SetMax
+func (tx *Tx) SetMax(id string, v uint64) error {
+	return tx.apply(&Event{Type: SetMax, Set: &SetInfo{Id: id, Value: v}})
+}
+
+// Advance adds n to the clock with the specified identifier,
+// with the same rules as VClock.Advance
+func (tx *Tx) Advance(id string, n uint64) error {
+	return tx.apply(&Event{Type: Advance, Set: &SetInfo{Id: id, Value: n}})
+}
+
+// Tick increments the clock with the specified identifier,
+// with the same rules as VClock.Tick
+func (tx *Tx) Tick(id string) error {
+	if len(id) == 0 {
+		return tx.fail(errClockIdMustNotBeEmptyString)
+	}
+	return tx.apply(&Event{Type: Tick, Tick: id})
+}
+
+// Merge combines the specified Clock, which must not be nil
+func (tx *Tx) Merge(c Clock) error {
+	if c == nil {
+		return tx.fail(errClockMustNotBeNil)
+	}
+	return tx.apply(&Event{Type: Merge, Merge: copyMap(c)})
+}
+
+// Get returns the value for the specified identifier within the transaction,
+// returning true if the identifier is found, otherwise false
+func (tx *Tx) Get(id string) (uint64, bool) {
+	v, ok := tx.c[tx.f(id)]
+	return v, ok
+}
+
+type reqUpdate struct {
+	fn func(tx *Tx) error
+}
+
+// Update applies all of the updates made to the Tx by the function as a single
+// Event of type Transaction.  If the function returns an error, or any of the
+// updates fail, then none of the updates are applied and the error is returned.
+// The function is executed whilst access to the clock is serialised, and so must
+// not call any methods of the VClock.
+func (vc *VClock) Update(fn func(tx *Tx) error) error {
+	if fn == nil {
+		return errTransactionFuncMustNotBeNil
+	}
+	return attemptSend(vc.backend, &reqUpdate{fn: fn})
+}
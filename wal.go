@@ -0,0 +1,253 @@
+package vclock
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+var errWALInvalidSequence = errors.New("write-ahead log contains an invalid sequence of records")
+var errWALCorrupt = errors.New("write-ahead log contains an invalid record before its end")
+var errWALClosed = errors.New("write-ahead log is closed")
+var errWALFailed = errors.New("write-ahead log failed to write an update, so no further updates can be made")
+var errWALRecordInvalid = errors.New("write-ahead log record is invalid")
+
+// walHeaderSize is the length of the header of each record, being the
+// length of the payload followed by its CRC32 checksum
+const walHeaderSize = 8
+
+// walRecord is the payload of each record in the write-ahead log.
+// The first record holds the initial Clock, and each subsequent record
+// holds an Event that was applied by the history.
+type walRecord struct {
+	HistoryId uint64
+	Time      time.Time
+	Clock     Clock
+	Change    *Event
+}
+
+// wal appends records to the write-ahead log file, synchronising the file
+// to storage after the number of records specified by syncEvery.
+// If a record cannot be written, the file is restored to its prior length
+// so that the record is not recovered, and if this is not possible, or the
+// file cannot be synchronised, all further records are rejected.
+type wal struct {
+	lock      sync.Mutex
+	f         *os.File
+	offset    int64
+	syncEvery int
+	unsynced  int
+	failed    bool
+}
+
+// append writes the record to the end of the log as a single write
+func (w *wal) append(r *walRecord) error {
+	var payload bytes.Buffer
+	if err := gob.NewEncoder(&payload).Encode(r); err != nil {
+		return err
+	}
+
+	rec := make([]byte, walHeaderSize, walHeaderSize+payload.Len())
+	binary.LittleEndian.PutUint32(rec[0:4], uint32(payload.Len()))
+	binary.LittleEndian.PutUint32(rec[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+	rec = append(rec, payload.Bytes()...)
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.f == nil {
+		return errWALClosed
+	}
+	if w.failed {
+		return errWALFailed
+	}
+
+	offset := w.offset
+	if _, err := w.f.Write(rec); err != nil {
+		return w.rollback(offset, err)
+	}
+	w.offset += int64(len(rec))
+
+	w.unsynced++
+	if w.syncEvery > 0 && w.unsynced >= w.syncEvery {
+		w.unsynced = 0
+		if err := w.f.Sync(); err != nil {
+			// Earlier records may not be durable, so the log cannot be trusted
+			w.rollback(offset, err)
+			w.failed = true
+			return err
+		}
+	}
+	return nil
+}
+
+// rollback restores the file to the specified length, discarding any part of
+// a record that was written, and marks the log as failed if this is not possible
+func (w *wal) rollback(offset int64, err error) error {
+	if terr := w.f.Truncate(offset); terr != nil {
+		w.failed = true
+		return err
+	}
+	if _, serr := w.f.Seek(offset, io.SeekStart); serr != nil {
+		w.failed = true
+		return err
+	}
+	w.offset = offset
+	return err
+}
+
+// close synchronises and closes the file, after which no records can be appended
+func (w *wal) close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+
+	f := w.f
+	w.f = nil
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readWALRecord reads the next record, of at most limit bytes, returning io.EOF if
+// there are no further records, io.ErrUnexpectedEOF if the record is incomplete, or
+// errWALRecordInvalid, together with the length of the record, if it fails validation
+func readWALRecord(r io.Reader, limit int64) (*walRecord, int64, error) {
+	header := make([]byte, walHeaderSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	n := int64(binary.LittleEndian.Uint32(header[0:4]))
+	if n > limit-walHeaderSize {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	size := int64(walHeaderSize + len(payload))
+	if crc32.ChecksumIEEE(payload) != binary.LittleEndian.Uint32(header[4:8]) {
+		return nil, size, errWALRecordInvalid
+	}
+
+	rec := &walRecord{}
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(rec); err != nil {
+		return nil, size, errWALRecordInvalid
+	}
+	return rec, size, nil
+}
+
+// openWAL opens or creates the write-ahead log file, returning the valid records and
+// the length of the file that they occupy.  The file is truncated after the last
+// valid record, discarding any torn write at its end, and is positioned so that
+// further records are appended.  An invalid record that is followed by further
+// data is not the result of a torn write, so is reported as corruption.
+func openWAL(path string) (*os.File, []*walRecord, int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, 0, err
+	}
+
+	records := []*walRecord{}
+	offset := int64(0)
+
+	r := bufio.NewReader(f)
+	for {
+		rec, n, err := readWALRecord(r, info.Size()-offset)
+		if err == io.EOF {
+			break
+		}
+		if err == errWALRecordInvalid && offset+n < info.Size() {
+			f.Close()
+			return nil, nil, 0, errWALCorrupt
+		}
+		if err != nil {
+			if err := f.Truncate(offset); err != nil {
+				f.Close()
+				return nil, nil, 0, err
+			}
+			break
+		}
+		records = append(records, rec)
+		offset += n
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, nil, 0, err
+	}
+	return f, records, offset, nil
+}
+
+// Open returns a VClock that maintains history, and which is made durable by
+// appending each update to the write-ahead log at the specified path.  If the
+// log exists, the VClock is recovered by replaying the updates it contains,
+// otherwise the log is created for an empty VClock.  Any incomplete or corrupted
+// record at the end of the log, such as that due to a crash, is discarded, whilst
+// an error is returned if an invalid record is followed by further records.
+// The log is closed when the VClock is closed or its context is completed.
+// Close returns once the log has been synchronised and closed.
+func Open(ctx context.Context, path string, shortenerName string, opts ...Option) (*VClock, error) {
+	f, records, offset, err := openWAL(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var init Clock
+	if len(records) > 0 {
+		init = records[0].Clock
+	}
+
+	v, state, o := newClockState(ctx, init, true, shortenerName, true, opts)
+	w := &wal{f: f, offset: offset, syncEvery: o.syncEvery}
+
+	fail := func(err error) (*VClock, error) {
+		v.cancel()
+		w.close()
+		return nil, err
+	}
+
+	if len(records) == 0 {
+		first := state.history.items[0]
+		if err := w.append(&walRecord{HistoryId: first.HistoryId, Time: first.Time, Clock: Clock{}}); err != nil {
+			return fail(err)
+		}
+	} else if err := state.history.recover(records); err != nil {
+		return fail(err)
+	}
+
+	state.history.wal = w
+	v.wal = w
+
+	// Close() closes the log directly, so that any error can be returned,
+	// whilst this ensures the log is also closed if the context completes
+	context.AfterFunc(v.ctx, func() { w.close() })
+
+	v.start(state, o.backend)
+	return v, nil
+}